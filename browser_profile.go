@@ -0,0 +1,193 @@
+package xapi
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// BrowserProfile is the fingerprint one identity presents: the User-Agent,
+// Accept-Language and client hints on every request, the navigator
+// properties inside its XPFF header and the order a browser sends headers in.
+// Keeping these consistent per identity avoids mixing a Chrome bootstrap
+// with Firefox API calls.
+//
+// Profiles are read-only once in use; modify a copy from BrowserProfiles.
+//
+// Example:
+//
+//	config := xapi.DefaultProductionConfig()
+//	config.BrowserProfile = xapi.LookupBrowserProfile("chrome-windows")
+//
+//	// Or rotate built-in profiles across pooled identities
+//	config.Identities = &xapi.IdentityPoolConfig{Guests: 4, Profiles: xapi.BrowserProfiles()}
+type BrowserProfile struct {
+	Name           string            `json:"name"`
+	UserAgent      string            `json:"user_agent"`
+	AcceptLanguage string            `json:"accept_language"`
+	ClientHints    map[string]string `json:"client_hints,omitempty"` // sec-ch-ua headers; Chromium only
+	HeaderOrder    []string          `json:"header_order,omitempty"` // Canonical header names in send order
+
+	// XPFF navigator properties; an empty UserAgent uses the profile's
+	Navigator NavigatorProperties `json:"navigator"`
+}
+
+// DefaultBrowserProfileName is the profile used when none is configured
+const DefaultBrowserProfileName = "firefox-linux"
+
+// Header order of fetch() requests to the API, as each engine sends them
+var (
+	firefoxHeaderOrder = []string{
+		"User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Referer", "Content-Type",
+		"X-Guest-Token", "X-Csrf-Token", "X-Twitter-Auth-Type", "X-Twitter-Client-Language",
+		"X-Twitter-Active-User", "X-Client-Transaction-Id", "X-Xp-Forwarded-For", "Authorization",
+		"Origin", "Connection", "Cookie", "Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site",
+	}
+	chromiumHeaderOrder = []string{
+		"Sec-Ch-Ua-Platform", "Authorization", "X-Csrf-Token", "X-Client-Transaction-Id",
+		"Sec-Ch-Ua", "X-Twitter-Client-Language", "Sec-Ch-Ua-Mobile", "X-Twitter-Active-User",
+		"X-Guest-Token", "X-Twitter-Auth-Type", "X-Xp-Forwarded-For", "User-Agent", "Content-Type",
+		"Accept", "Origin", "Sec-Fetch-Site", "Sec-Fetch-Mode", "Sec-Fetch-Dest", "Referer",
+		"Accept-Encoding", "Accept-Language", "Cookie",
+	}
+	safariHeaderOrder = []string{
+		"Accept", "Content-Type", "Origin", "Authorization", "X-Csrf-Token", "X-Guest-Token",
+		"Sec-Fetch-Site", "X-Twitter-Client-Language", "Sec-Fetch-Mode", "Accept-Language",
+		"User-Agent", "Referer", "X-Twitter-Active-User", "X-Client-Transaction-Id",
+		"X-Xp-Forwarded-For", "X-Twitter-Auth-Type", "Sec-Fetch-Dest", "Accept-Encoding", "Cookie",
+	}
+)
+
+// BrowserProfiles returns copies of the built-in profiles, the default first
+func BrowserProfiles() []*BrowserProfile {
+	browser := NavigatorProperties{HasBeenActive: "true", Webdriver: "false"}
+	order := func(names []string) []string { return append([]string(nil), names...) }
+	return []*BrowserProfile{
+		{
+			Name:           "firefox-linux",
+			UserAgent:      defaultUserAgent,
+			AcceptLanguage: "en-US,en;q=0.5",
+			HeaderOrder:    order(firefoxHeaderOrder),
+			Navigator:      browser,
+		},
+		{
+			Name:           "firefox-windows",
+			UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:141.0) Gecko/20100101 Firefox/141.0",
+			AcceptLanguage: "en-US,en;q=0.5",
+			HeaderOrder:    order(firefoxHeaderOrder),
+			Navigator:      browser,
+		},
+		{
+			Name:           "chrome-windows",
+			UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36",
+			AcceptLanguage: "en-US,en;q=0.9",
+			ClientHints: map[string]string{
+				"Sec-Ch-Ua":          `"Not)A;Brand";v="99", "Google Chrome";v="127", "Chromium";v="127"`,
+				"Sec-Ch-Ua-Mobile":   "?0",
+				"Sec-Ch-Ua-Platform": `"Windows"`,
+			},
+			HeaderOrder: order(chromiumHeaderOrder),
+			Navigator:   browser,
+		},
+		{
+			Name:           "chrome-macos",
+			UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36",
+			AcceptLanguage: "en-US,en;q=0.9",
+			ClientHints: map[string]string{
+				"Sec-Ch-Ua":          `"Not)A;Brand";v="99", "Google Chrome";v="127", "Chromium";v="127"`,
+				"Sec-Ch-Ua-Mobile":   "?0",
+				"Sec-Ch-Ua-Platform": `"macOS"`,
+			},
+			HeaderOrder: order(chromiumHeaderOrder),
+			Navigator:   browser,
+		},
+		{
+			Name:           "edge-windows",
+			UserAgent:      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36 Edg/127.0.0.0",
+			AcceptLanguage: "en-US,en;q=0.9",
+			ClientHints: map[string]string{
+				"Sec-Ch-Ua":          `"Not)A;Brand";v="99", "Microsoft Edge";v="127", "Chromium";v="127"`,
+				"Sec-Ch-Ua-Mobile":   "?0",
+				"Sec-Ch-Ua-Platform": `"Windows"`,
+			},
+			HeaderOrder: order(chromiumHeaderOrder),
+			Navigator:   browser,
+		},
+		{
+			Name:           "safari-macos",
+			UserAgent:      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+			AcceptLanguage: "en-US,en;q=0.9",
+			HeaderOrder:    order(safariHeaderOrder),
+			Navigator:      browser,
+		},
+	}
+}
+
+// LookupBrowserProfile returns a copy of the built-in profile with the given name, or nil
+func LookupBrowserProfile(name string) *BrowserProfile {
+	for _, profile := range BrowserProfiles() {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+// defaultBrowserProfile is shared by every identity without a configured profile
+var defaultBrowserProfile = LookupBrowserProfile(DefaultBrowserProfileName)
+
+// navigator returns the XPFF navigator properties with the profile's User-Agent filled in
+func (p *BrowserProfile) navigator() NavigatorProperties {
+	nav := p.Navigator
+	if nav.UserAgent == "" {
+		nav.UserAgent = p.UserAgent
+	}
+	return nav
+}
+
+// apply sets the profile's User-Agent, Accept-Language and client hints on a request
+// and makes the profile available to the transport through BrowserProfileFromRequest
+func (p *BrowserProfile) apply(req *http.Request) *http.Request {
+	req.Header.Set("User-Agent", p.UserAgent)
+	if p.AcceptLanguage != "" {
+		req.Header.Set("Accept-Language", p.AcceptLanguage)
+	}
+	for name, value := range p.ClientHints {
+		req.Header.Set(name, value)
+	}
+	return req.WithContext(context.WithValue(req.Context(), browserProfileKey{}, p))
+}
+
+// OrderedKeys returns the keys of h in the profile's header order, followed
+// by headers the order does not list in alphabetical order. net/http always
+// writes headers sorted, so ordering takes a custom Transport that writes
+// them itself; it can find the profile with BrowserProfileFromRequest.
+func (p *BrowserProfile) OrderedKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	listed := make(map[string]bool, len(p.HeaderOrder))
+	for _, name := range p.HeaderOrder {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := h[name]; ok && !listed[name] {
+			keys = append(keys, name)
+		}
+		listed[name] = true
+	}
+
+	var rest []string
+	for name := range h {
+		if !listed[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+type browserProfileKey struct{}
+
+// BrowserProfileFromRequest returns the profile a client request was built
+// with, or nil for requests the client did not build
+func BrowserProfileFromRequest(req *http.Request) *BrowserProfile {
+	profile, _ := req.Context().Value(browserProfileKey{}).(*BrowserProfile)
+	return profile
+}
@@ -0,0 +1,164 @@
+package xapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestBuiltinBrowserProfiles(t *testing.T) {
+	names := make(map[string]bool)
+	for _, profile := range BrowserProfiles() {
+		if names[profile.Name] || profile.UserAgent == "" || profile.AcceptLanguage == "" || len(profile.HeaderOrder) == 0 {
+			t.Errorf("Incomplete or duplicate profile: %+v", profile)
+		}
+		names[profile.Name] = true
+	}
+	if !names[DefaultBrowserProfileName] || defaultBrowserProfile.UserAgent != defaultUserAgent {
+		t.Error("The default profile should be built in")
+	}
+	if LookupBrowserProfile("netscape") != nil {
+		t.Error("Unknown profile names should return nil")
+	}
+
+	// Copies are independent of the built-ins
+	profile := LookupBrowserProfile("chrome-windows")
+	profile.HeaderOrder[0] = "X-Changed"
+	profile.ClientHints["Sec-Ch-Ua-Mobile"] = "?1"
+	fresh := LookupBrowserProfile("chrome-windows")
+	if fresh.HeaderOrder[0] == "X-Changed" || fresh.ClientHints["Sec-Ch-Ua-Mobile"] != "?0" {
+		t.Error("Modifying a returned profile should not change the built-ins")
+	}
+
+	h := http.Header{}
+	for _, name := range []string{"Cookie", "User-Agent", "X-Custom", "Authorization", "A-Custom"} {
+		h.Set(name, "v")
+	}
+	got := (&BrowserProfile{HeaderOrder: []string{"user-agent", "Authorization", "Accept", "Cookie"}}).OrderedKeys(h)
+	if want := []string{"User-Agent", "Authorization", "Cookie", "A-Custom", "X-Custom"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("OrderedKeys = %v, want %v", got, want)
+	}
+}
+
+// profileRecorder records the browser profile of each request the client sends
+type profileRecorder struct {
+	mu         sync.Mutex
+	profiles   map[string]bool
+	unprofiled []string // Paths of requests a transport could not order
+	next       http.RoundTripper
+}
+
+func (r *profileRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	if profile := BrowserProfileFromRequest(req); profile != nil && len(profile.OrderedKeys(req.Header)) == len(req.Header) {
+		r.profiles[profile.Name] = true
+	} else {
+		r.unprofiled = append(r.unprofiled, req.URL.Path)
+	}
+	r.mu.Unlock()
+	return r.next.RoundTrip(req)
+}
+
+func TestClientBrowserProfiles(t *testing.T) {
+	server := newStandIn(t)
+
+	type seen struct{ userAgent, language, hints, xpffAgent string }
+	var mu sync.Mutex
+	byGuest := make(map[string]map[seen]bool)
+	xpff := NewXPFFGenerator()
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("guest_id")
+		s := seen{userAgent: r.UserAgent(), language: r.Header.Get("Accept-Language"), hints: r.Header.Get("Sec-Ch-Ua")}
+		if payload, err := xpff.DecryptXPFF(r.Header.Get("X-Xp-Forwarded-For"), cookie.Value); err == nil {
+			s.xpffAgent = payload.NavigatorProperties.UserAgent
+		}
+		mu.Lock()
+		if byGuest[cookie.Value] == nil {
+			byGuest[cookie.Value] = make(map[seen]bool)
+		}
+		byGuest[cookie.Value][s] = true
+		mu.Unlock()
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	chrome, safari, edge := LookupBrowserProfile("chrome-windows"), LookupBrowserProfile("safari-macos"), LookupBrowserProfile("edge-windows")
+	recorder := &profileRecorder{profiles: make(map[string]bool), next: http.DefaultTransport}
+	config := server.config()
+	config.Transport = recorder
+	config.BrowserProfile = edge
+	config.Identities = &IdentityPoolConfig{Guests: 2, Profiles: []*BrowserProfile{chrome, safari}}
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+	for i := 0; i < 6; i++ {
+		if _, err := client.User(context.Background(), "nasa"); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+
+	// Every request from one guest ID presents one consistent browser
+	want := map[string]seen{
+		chrome.UserAgent: {chrome.UserAgent, chrome.AcceptLanguage, chrome.ClientHints["Sec-Ch-Ua"], chrome.UserAgent},
+		safari.UserAgent: {safari.UserAgent, safari.AcceptLanguage, "", safari.UserAgent},
+	}
+	used := make(map[string]bool)
+	for guestID, variants := range byGuest {
+		if len(variants) != 1 {
+			t.Errorf("Guest %s presented %d fingerprints: %v", guestID, len(variants), variants)
+		}
+		for s := range variants {
+			if want[s.userAgent] != s {
+				t.Errorf("Guest %s sent inconsistent headers: %+v", guestID, s)
+			}
+			used[s.userAgent] = true
+		}
+	}
+	if len(used) != 2 {
+		t.Errorf("Expected both profiles in rotation, got %v", used)
+	}
+
+	for _, agent := range server.userAgents("/1.1/guest/activate.json") {
+		if _, ok := want[agent]; !ok {
+			t.Errorf("Guest activation sent a User-Agent outside the identities' profiles: %s", agent)
+		}
+	}
+	if _, err := client.DiscoverOperations(context.Background()); err != nil {
+		t.Fatalf("DiscoverOperations failed: %v", err)
+	}
+	for _, path := range []string{"/", "/responsive-web/client-web/ondemand.s." + fixtureOnDemandHash + "a.js", "/responsive-web/client-web/main." + fixtureMainHash + ".js"} {
+		if agents := server.userAgents(path); len(agents) != 1 || agents[0] != chrome.UserAgent {
+			t.Errorf("Download of %s should present the primary identity's profile, got %v", path, agents)
+		}
+	}
+	if !recorder.profiles["chrome-windows"] || !recorder.profiles["safari-macos"] {
+		t.Errorf("Transport should see each request's profile, got %v", recorder.profiles)
+	}
+	if len(recorder.unprofiled) > 0 {
+		t.Errorf("Every request, downloads included, should carry its profile's header order, missing on %v", recorder.unprofiled)
+	}
+
+	stats := client.IdentityStats()
+	for _, s := range stats {
+		if s.Profile != "chrome-windows" && s.Profile != "safari-macos" {
+			t.Errorf("Unexpected identity profile %q", s.Profile)
+		}
+	}
+
+	// A session's own profile takes precedence over the pool's
+	session := &Session{AuthToken: "token", CSRFToken: "ct0", Profile: LookupBrowserProfile("firefox-windows")}
+	if err := client.SetSession(session); err != nil {
+		t.Fatalf("SetSession failed: %v", err)
+	}
+	if got := client.identities.primary().browserProfile().Name; got != "firefox-windows" {
+		t.Errorf("Expected the session profile, got %s", got)
+	}
+	if err := client.SetSession(&Session{AuthToken: "token", CSRFToken: "ct0", Profile: &BrowserProfile{}}); err == nil {
+		t.Error("A profile without a user agent should be rejected")
+	}
+}
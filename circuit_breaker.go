@@ -0,0 +1,222 @@
+package xapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by errors.Is when a request was rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitOpenError is returned without contacting the server while the circuit
+// for an operation and identity is open
+type CircuitOpenError struct {
+	Operation string    // GraphQL operation name
+	Identity  string    // Identity the circuit belongs to
+	RetryAt   time.Time // When the circuit will allow a probe request
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for %s (%s), next probe at %s",
+		e.Operation, e.Identity, e.RetryAt.Format(time.RFC3339))
+}
+
+// Is makes CircuitOpenError match ErrCircuitOpen
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of a single circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // Requests flow normally
+	CircuitOpen     CircuitState = "open"      // Requests fail fast with ErrCircuitOpen
+	CircuitHalfOpen CircuitState = "half_open" // A limited number of probes test recovery
+)
+
+// CircuitBreakerConfig controls when circuits open and how they recover
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // Consecutive failures before the circuit opens (0 disables the breaker)
+	OpenTimeout      time.Duration // How long the circuit stays open before probing
+	HalfOpenProbes   int           // Probe requests allowed while half-open, all must succeed to close
+}
+
+// DefaultCircuitBreakerConfig returns settings that open after 5 consecutive
+// transport failures and probe again after 30 seconds
+func DefaultCircuitBreakerConfig() *CircuitBreakerConfig {
+	return &CircuitBreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+		HalfOpenProbes:   1,
+	}
+}
+
+// CircuitBreakerStats reports the state of one circuit for monitoring
+type CircuitBreakerStats struct {
+	Operation           string       `json:"operation"`
+	Identity            string       `json:"identity"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Trips               int64        `json:"trips"`
+	Rejections          int64        `json:"rejections"`
+	OpenedAt            time.Time    `json:"opened_at,omitempty"`
+}
+
+// circuitBreaker guards one operation for one identity
+type circuitBreaker struct {
+	stats          CircuitBreakerStats
+	probesInFlight int
+	probeSuccesses int
+}
+
+// circuitBreakers holds one breaker per operation and identity
+type circuitBreakers struct {
+	config   *CircuitBreakerConfig
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(config *CircuitBreakerConfig) *circuitBreakers {
+	return &circuitBreakers{
+		config:   config,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+func (cb *circuitBreakers) enabled() bool {
+	return cb.config != nil && cb.config.FailureThreshold > 0
+}
+
+// get returns the breaker for an operation and identity, creating it closed.
+// The caller must hold cb.mu.
+func (cb *circuitBreakers) get(operation, identity string) *circuitBreaker {
+	key := operation + "|" + identity
+	breaker, ok := cb.breakers[key]
+	if !ok {
+		breaker = &circuitBreaker{stats: CircuitBreakerStats{
+			Operation: operation,
+			Identity:  identity,
+			State:     CircuitClosed,
+		}}
+		cb.breakers[key] = breaker
+	}
+	return breaker
+}
+
+// allow admits a request or rejects it with a *CircuitOpenError.
+// It returns true when the admitted request is a half-open probe.
+func (cb *circuitBreakers) allow(operation, identity string) (bool, error) {
+	if !cb.enabled() {
+		return false, nil
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	breaker := cb.get(operation, identity)
+	retryAt := breaker.stats.OpenedAt.Add(cb.config.OpenTimeout)
+
+	switch breaker.stats.State {
+	case CircuitOpen:
+		if time.Now().Before(retryAt) {
+			breaker.stats.Rejections++
+			return false, &CircuitOpenError{Operation: operation, Identity: identity, RetryAt: retryAt}
+		}
+		breaker.stats.State = CircuitHalfOpen
+		breaker.probeSuccesses = 0
+		fallthrough
+
+	case CircuitHalfOpen:
+		if breaker.probesInFlight >= max(cb.config.HalfOpenProbes, 1) {
+			breaker.stats.Rejections++
+			return false, &CircuitOpenError{Operation: operation, Identity: identity, RetryAt: retryAt}
+		}
+		breaker.probesInFlight++
+		return true, nil
+
+	default:
+		return false, nil
+	}
+}
+
+// record updates the breaker with the outcome of an admitted request
+func (cb *circuitBreakers) record(operation, identity string, probe bool, err error) {
+	if !cb.enabled() {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	breaker := cb.get(operation, identity)
+	if probe && breaker.probesInFlight > 0 {
+		breaker.probesInFlight--
+	}
+
+	if isNeutralForBreaker(err) {
+		return
+	}
+
+	if !countsAsBreakerFailure(err) {
+		// The server answered, so the transport is healthy
+		breaker.stats.ConsecutiveFailures = 0
+		if breaker.stats.State == CircuitHalfOpen {
+			breaker.probeSuccesses++
+			if breaker.probeSuccesses >= max(cb.config.HalfOpenProbes, 1) {
+				breaker.stats.State = CircuitClosed
+				breaker.stats.OpenedAt = time.Time{}
+			}
+		}
+		return
+	}
+
+	breaker.stats.ConsecutiveFailures++
+	if breaker.stats.State == CircuitHalfOpen || breaker.stats.ConsecutiveFailures >= cb.config.FailureThreshold {
+		if breaker.stats.State != CircuitOpen {
+			breaker.stats.Trips++
+		}
+		breaker.stats.State = CircuitOpen
+		breaker.stats.OpenedAt = time.Now()
+	}
+}
+
+// snapshot returns the stats of every breaker
+func (cb *circuitBreakers) snapshot() []CircuitBreakerStats {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	stats := make([]CircuitBreakerStats, 0, len(cb.breakers))
+	for _, breaker := range cb.breakers {
+		stats = append(stats, breaker.stats)
+	}
+	return stats
+}
+
+// isNeutralForBreaker reports outcomes that say nothing about server health:
+// cancelled contexts, local rate limit pauses and rejections by the breaker itself
+func isNeutralForBreaker(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) && rateErr.HTTPError == nil {
+		return true
+	}
+	switch ClassifyError(err) {
+	case ErrorClassCanceled, ErrorClassCircuitOpen:
+		return true
+	}
+	return false
+}
+
+// countsAsBreakerFailure reports failures that mean the server is rejecting us
+func countsAsBreakerFailure(err error) bool {
+	switch ClassifyError(err) {
+	case ErrorClassNetwork, ErrorClassServer, ErrorClassRateLimit, ErrorClassAuth:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,1017 @@
+package xapi
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fixture material for the local stand-in server. The key, indices and frames
+// are synthetic but shaped like the real homepage and ondemand.s bundle.
+const (
+	fixtureOnDemandHash = "5f2b8a1"
+	fixtureMainHash     = "8c1e4d07"
+	fixtureAPIHash      = "3a9d6e2"
+)
+
+var fixtureKeyBytes = func() []byte {
+	key := make([]byte, 48)
+	for i := range key {
+		key[i] = byte(i*37 + 11)
+	}
+	return key
+}()
+
+func fixtureOnDemandJS() string {
+	return fixtureOnDemandJSFor(7, 21, 33, 42)
+}
+
+// fixtureOnDemandJSFor builds an ondemand.s bundle carrying the row index
+// followed by the key byte indices
+func fixtureOnDemandJSFor(indices ...int) string {
+	vars := make([]string, len(indices))
+	for i, index := range indices {
+		vars[i] = fmt.Sprintf("%c=parseInt(a[%d], 16)", 'o'+i, index)
+	}
+	return `"use strict";(self.webpackChunk=self.webpackChunk||[]).push([[1],{1:(e,t,n)=>{` +
+		`var ` + strings.Join(vars, ",") + `;` +
+		`}}]);`
+}
+
+func fixtureHomeHTML() string {
+	return fixtureHomeHTMLFor(fixtureKeyBytes, 53)
+}
+
+// fixtureHomeHTMLFor builds a homepage with the given verification key and
+// animation frames derived from frameSeed
+func fixtureHomeHTMLFor(key []byte, frameSeed int) string {
+	return fixtureHomeHTMLWithRows(key, frameSeed, 11)
+}
+
+// fixtureHomeHTMLWithRows is fixtureHomeHTMLFor with frame rows of the given length
+func fixtureHomeHTMLWithRows(key []byte, frameSeed, columns int) string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html><head>`)
+	fmt.Fprintf(&b, `<meta name="twitter-site-verification" content="%s"/>`, base64.StdEncoding.EncodeToString(key))
+	b.WriteString(`</head><body><svg>`)
+	for frame := 0; frame < 4; frame++ {
+		fmt.Fprintf(&b, `<g id="loading-x-anim-%d"><path d="M 10,30 C`, frame)
+		for row := 0; row < 16; row++ {
+			if row > 0 {
+				b.WriteString(" C")
+			}
+			for col := 0; col < columns; col++ {
+				fmt.Fprintf(&b, " %d", (frame*frameSeed+row*29+col*17)%256)
+			}
+		}
+		b.WriteString(`"></path></g>`)
+	}
+	fmt.Fprintf(&b, `</svg><script>window.__INITIAL_STATE__=%s;window.__META_DATA__={};</script>`, fixtureInitialState)
+	fmt.Fprintf(&b, `<script>window.__SCRIPTS__={"ondemand.s":"%s","api":"%s"};</script>`, fixtureOnDemandHash, fixtureAPIHash)
+	fmt.Fprintf(&b, `<script src="https://abs.twimg.com/responsive-web/client-web/main.%s.js"></script></body></html>`, fixtureMainHash)
+	return b.String()
+}
+
+// fixtureInitialState carries feature switches that differ from the built-in
+// defaults: the per-user value of responsive_web_jetfuel_frame overrides its
+// default and search_max_results is not a boolean
+const fixtureInitialState = `{"optimist":[],"featureSwitch":{"defaultConfig":{` +
+	`"responsive_web_jetfuel_frame":{"value":true},"rweb_video_screen_enabled":{"value":true},"search_max_results":{"value":50}},` +
+	`"user":{"config":{"responsive_web_jetfuel_frame":{"value":false}}}}}`
+
+// fixtureBundleJS returns a web app bundle defining the given GraphQL operations
+func fixtureBundleJS(ops ...Operation) string {
+	var b strings.Builder
+	for i, op := range ops {
+		var toggles []string
+		for name := range op.FieldToggles {
+			toggles = append(toggles, `"`+name+`"`)
+		}
+		features := make([]string, 0, len(op.FeatureSwitches))
+		for _, name := range op.FeatureSwitches {
+			features = append(features, `"`+name+`"`)
+		}
+		fmt.Fprintf(&b, `%d:e=>{e.exports={queryId:"%s",operationName:"%s",operationType:"query",metadata:{featureSwitches:[%s],fieldToggles:[%s]}}},`,
+			i, op.QueryID, op.Name, strings.Join(features, ","), strings.Join(toggles, ","))
+	}
+	return b.String()
+}
+
+// standIn is a local replacement for api.x.com, x.com and abs.twimg.com
+type standIn struct {
+	*httptest.Server
+	graphql       atomic.Value // http.HandlerFunc
+	homeFetches   atomic.Int64
+	graphqlCalls  atomic.Int64
+	activations   atomic.Int64
+	homeDown      atomic.Bool  // Homepage answers 503
+	homeGate      atomic.Value // chan struct{} the homepage waits on, if set
+	apiBundle     atomic.Value // string served as the api.*.js bundle
+	bundleFetches atomic.Int64
+
+	agentsMu sync.Mutex
+	agents   map[string]map[string]bool // User-Agents seen per path
+}
+
+// userAgents returns the distinct User-Agents that requested a path
+func (s *standIn) userAgents(path string) []string {
+	s.agentsMu.Lock()
+	defer s.agentsMu.Unlock()
+
+	var agents []string
+	for agent := range s.agents[path] {
+		agents = append(agents, agent)
+	}
+	return agents
+}
+
+func newStandIn(t *testing.T) *standIn {
+	t.Helper()
+
+	s := &standIn{}
+	s.graphql.Store(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"errors":[{"message":"no handler"}]}`, http.StatusNotImplemented)
+	}))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		s.homeFetches.Add(1)
+		if gate, ok := s.homeGate.Load().(chan struct{}); ok {
+			<-gate
+		}
+		if s.homeDown.Load() {
+			http.Error(w, "over capacity", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, fixtureHomeHTML())
+	})
+	mux.HandleFunc("/responsive-web/client-web/ondemand.s."+fixtureOnDemandHash+"a.js", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fixtureOnDemandJS())
+	})
+	mux.HandleFunc("/responsive-web/client-web/main."+fixtureMainHash+".js", func(w http.ResponseWriter, r *http.Request) {
+		s.bundleFetches.Add(1)
+		fmt.Fprint(w, fixtureBundleJS(DefaultOperations()...))
+	})
+	mux.HandleFunc("/responsive-web/client-web/api."+fixtureAPIHash+"a.js", func(w http.ResponseWriter, r *http.Request) {
+		s.bundleFetches.Add(1)
+		bundle, _ := s.apiBundle.Load().(string)
+		fmt.Fprint(w, bundle)
+	})
+	mux.HandleFunc("/1.1/guest/activate.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Authorization") != "Bearer "+BearerToken {
+			http.Error(w, `{"errors":[{"code":32,"message":"Could not authenticate you."}]}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"guest_token":"gt-%d"}`, s.activations.Add(1))
+	})
+	mux.HandleFunc("/graphql/", func(w http.ResponseWriter, r *http.Request) {
+		s.graphqlCalls.Add(1)
+		s.graphql.Load().(http.HandlerFunc)(w, r)
+	})
+
+	s.agents = make(map[string]map[string]bool)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.agentsMu.Lock()
+		if s.agents[r.URL.Path] == nil {
+			s.agents[r.URL.Path] = make(map[string]bool)
+		}
+		s.agents[r.URL.Path][r.UserAgent()] = true
+		s.agentsMu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// handleGraphQL replaces the GraphQL handler
+func (s *standIn) handleGraphQL(h http.HandlerFunc) {
+	s.graphql.Store(h)
+}
+
+// config returns a fast-retrying config pointed at the stand-in
+func (s *standIn) config() *ProductionConfig {
+	config := DefaultProductionConfig()
+	config.Endpoints = EndpointsFor(s.URL)
+	config.RetryBackoffBase = time.Millisecond
+	config.RateLimitRequests = 1000
+	return config
+}
+
+func (s *standIn) client(t *testing.T) *Client {
+	t.Helper()
+	client, err := NewClient(s.config())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+const fixtureUserResponse = `{"data":{"user":{"result":{"__typename":"User","rest_id":"11348282","core":{"name":"NASA","screen_name":"NASA","created_at":"Wed Dec 19 20:20:32 +0000 2007"},"legacy":{"followers_count":89000000,"description":"Explore the universe"}}}}}`
+
+func TestStandInEndpoints(t *testing.T) {
+	server := newStandIn(t)
+
+	var gotPath, gotTxnID string
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotTxnID = r.Header.Get("X-Client-Transaction-Id")
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	client := server.client(t)
+	user, err := client.User(context.Background(), "@nasa")
+	if err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	if user.ID != "11348282" || user.ScreenName != "NASA" || user.FollowersCount != 89000000 {
+		t.Errorf("Unexpected user: %+v", user)
+	}
+	if gotPath != "/graphql/ck5KkZ8t5cOmoLssopN99Q/UserByScreenName" {
+		t.Errorf("Unexpected GraphQL path: %s", gotPath)
+	}
+	if gotTxnID == "" {
+		t.Error("Transaction ID header should be set")
+	}
+	if server.homeFetches.Load() != 1 {
+		t.Errorf("Expected 1 homepage fetch, got %d", server.homeFetches.Load())
+	}
+}
+
+func TestEndpointsURLs(t *testing.T) {
+	endpoints := EndpointsFor("http://127.0.0.1:8080/")
+
+	if got := endpoints.GraphQLURL("abc/UserByScreenName"); got != "http://127.0.0.1:8080/graphql/abc/UserByScreenName" {
+		t.Errorf("GraphQLURL = %s", got)
+	}
+	if got := endpoints.HomeURL(); got != "http://127.0.0.1:8080" {
+		t.Errorf("HomeURL = %s", got)
+	}
+	if got := endpoints.OnDemandURL("abc"); got != "http://127.0.0.1:8080/responsive-web/client-web/ondemand.s.abca.js" {
+		t.Errorf("OnDemandURL = %s", got)
+	}
+
+	var config *ProductionConfig
+	if config.endpoints().API != "https://api.x.com" {
+		t.Error("nil config should resolve to the live hosts")
+	}
+}
+
+// countingTransport is a test double that records every outbound request
+type countingTransport struct {
+	requests atomic.Int64
+	next     http.RoundTripper
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return c.next.RoundTrip(req)
+}
+
+func TestSharedTransport(t *testing.T) {
+	server := newStandIn(t)
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	transport := &countingTransport{next: http.DefaultTransport}
+	config := server.config()
+	config.Transport = transport
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if httpClient, _ := client.txnGen.fetchAs(); client.http != httpClient {
+		t.Error("Client and transaction generator should share one HTTP client")
+	}
+
+	if _, err := client.User(context.Background(), "nasa"); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	// homepage + ondemand.s bootstrap, guest activation, then one GraphQL request
+	if got := transport.requests.Load(); got != 4 {
+		t.Errorf("Expected 4 requests through the custom transport, got %d", got)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	server := newStandIn(t)
+	config := server.config()
+	config.EnableAutoRetry = false
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	respond := func(status int, header map[string]string, body string) {
+		server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		})
+	}
+
+	// Empty result on 200 is a plain not-found
+	respond(200, nil, `{"data":{"user":{}}}`)
+	if _, err := client.User(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// GraphQL errors on 200 are parsed and wrap APIError
+	respond(200, nil, `{"errors":[{"message":"User not found","code":50,"kind":"NonFatal","path":["user",0]}]}`)
+	_, err = client.User(ctx, "missing")
+	var gqlErr *GraphQLError
+	var apiErr *APIError
+	if !errors.As(err, &gqlErr) || !errors.As(err, &apiErr) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected GraphQLError wrapping APIError, got %v", err)
+	}
+	if apiErr.Code != 50 || gqlErr.StatusCode != 200 || !reflect.DeepEqual(apiErr.Path, []string{"user", "0"}) {
+		t.Errorf("Unexpected API error: %+v", apiErr)
+	}
+
+	// 401 is an AuthError that also unwraps to HTTPError
+	respond(401, map[string]string{"X-Test": "yes"}, `denied`)
+	_, err = client.User(ctx, "nasa")
+	var authErr *AuthError
+	var httpErr *HTTPError
+	if !errors.As(err, &authErr) || !errors.As(err, &httpErr) {
+		t.Fatalf("Expected AuthError, got %v", err)
+	}
+	if httpErr.StatusCode != 401 || string(httpErr.Body) != "denied" || httpErr.Header.Get("X-Test") != "yes" {
+		t.Errorf("Unexpected HTTP error: %+v", httpErr)
+	}
+
+	// Anything else is a plain HTTPError
+	respond(503, nil, `unavailable`)
+	_, err = client.User(ctx, "nasa")
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != 503 || errors.As(err, &authErr) {
+		t.Errorf("Expected 503 HTTPError, got %v", err)
+	}
+
+	// 429 carries the reset time
+	reset := time.Now().Add(time.Minute).Unix()
+	respond(429, map[string]string{"x-rate-limit-reset": fmt.Sprint(reset), "x-rate-limit-limit": "50"}, `{"errors":[{"message":"Rate limit exceeded","code":88}]}`)
+	_, err = client.User(ctx, "nasa")
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) {
+		t.Fatalf("Expected RateLimitError, got %v", err)
+	}
+	if rateErr.Reset.Unix() != reset || rateErr.Limit != 50 || rateErr.Errors[0].Code != 88 {
+		t.Errorf("Unexpected rate limit error: %+v", rateErr)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	server := newStandIn(t)
+	reset := time.Now().Add(time.Second).Unix()
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-rate-limit-limit", "50")
+		w.Header().Set("x-rate-limit-remaining", "0")
+		w.Header().Set("x-rate-limit-reset", fmt.Sprint(reset))
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	config := server.config()
+	config.EnableAutoRetry = false
+	config.MaxRateLimitWait = 0
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := client.User(ctx, "nasa"); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	state, ok := client.RateLimitStatus()["UserByScreenName"]
+	if !ok || state.Limit != 50 || state.Remaining != 0 || state.Reset.Unix() != reset {
+		t.Fatalf("Unexpected rate limit state: %+v", state)
+	}
+
+	// The exhausted operation fails fast without touching the server
+	_, err = client.User(ctx, "nasa")
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.HTTPError != nil || rateErr.Operation != "UserByScreenName" {
+		t.Fatalf("Expected local RateLimitError, got %v", err)
+	}
+	if server.graphqlCalls.Load() != 1 {
+		t.Errorf("Paused operation should not reach the server, got %d calls", server.graphqlCalls.Load())
+	}
+
+	// With a longer allowance the operation waits for the reset instead
+	config.MaxRateLimitWait = 5 * time.Second
+	if _, err := client.User(ctx, "nasa"); err != nil {
+		t.Fatalf("Expected request to succeed after reset: %v", err)
+	}
+	if time.Now().Unix() < reset {
+		t.Error("Request should have waited for the reset time")
+	}
+}
+
+func TestRetryAllEndpoints(t *testing.T) {
+	server := newStandIn(t)
+
+	// Every operation fails once with a 503, then succeeds
+	var failed sync.Map
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		if _, seen := failed.LoadOrStore(r.URL.Path, true); !seen {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		switch operationName(r.URL.Path) {
+		case "TweetResultByRestId":
+			fmt.Fprint(w, `{"data":{"tweetResult":{"result":{"rest_id":"1","legacy":{"full_text":"hello"}}}}}`)
+		case "BroadcastQuery":
+			fmt.Fprint(w, `{"data":{"broadcast":{"id":"b1"}}}`)
+		case "UsersByRestIds":
+			fmt.Fprint(w, `{"data":{"users":[{"result":{"rest_id":"1","legacy":{"name":"a"}}}]}}`)
+		default:
+			fmt.Fprint(w, `{"data":{"user":{"result":{"timeline":{"instructions":[]}}}}}`)
+		}
+	})
+
+	client := server.client(t)
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"Tweet":        func() error { _, err := client.Tweet(ctx, "1"); return err },
+		"Broadcast":    func() error { _, err := client.Broadcast(ctx, "b1"); return err },
+		"Highlights":   func() error { _, err := client.Highlights(ctx, "1", 5); return err },
+		"Following":    func() error { _, err := client.Following(ctx, "1", 5); return err },
+		"Followers":    func() error { _, err := client.Followers(ctx, "1", 5); return err },
+		"BlueVerified": func() error { _, err := client.BlueVerified(ctx, "1", 5); return err },
+		"UserBusiness": func() error { _, err := client.UserBusiness(ctx, "1", "", 5); return err },
+		"UsersByIDs":   func() error { _, err := client.UsersByIDs(ctx, []string{"1"}); return err },
+	}
+	for name, call := range calls {
+		if err := call(); err != nil {
+			t.Errorf("%s should succeed after one retry: %v", name, err)
+		}
+	}
+
+	metrics := client.GetMetrics()
+	if metrics.TotalRequests != int64(len(calls)) {
+		t.Errorf("Expected %d total requests, got %d", len(calls), metrics.TotalRequests)
+	}
+	if metrics.RetryAttempts != int64(len(calls)) {
+		t.Errorf("Expected %d retry attempts, got %d", len(calls), metrics.RetryAttempts)
+	}
+
+	// Tweets by username resolves the user and fetches the timeline as one
+	// retried request: the lookup and the timeline each fail once
+	if _, err := client.Tweets(ctx, "nasa"); err != nil {
+		t.Fatalf("Tweets should succeed after retries: %v", err)
+	}
+	after := client.GetMetrics()
+	if after.TotalRequests != metrics.TotalRequests+1 || after.RetryAttempts != metrics.RetryAttempts+2 {
+		t.Errorf("Expected one request with two retries, got %d requests and %d retries",
+			after.TotalRequests-metrics.TotalRequests, after.RetryAttempts-metrics.RetryAttempts)
+	}
+
+	// Profile looks the user up once
+	calls0 := server.graphqlCalls.Load()
+	if _, err := client.Profile(ctx, "nasa", 5); err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	if n := server.graphqlCalls.Load() - calls0; n != 2 {
+		t.Errorf("Expected a user lookup and a timeline request, got %d calls", n)
+	}
+	if final := client.GetMetrics(); final.TotalRequests != after.TotalRequests+1 {
+		t.Errorf("Profile should count as one request, got %d", final.TotalRequests-after.TotalRequests)
+	}
+}
+
+func TestRetryPolicyClassification(t *testing.T) {
+	server := newStandIn(t)
+	client := server.client(t)
+	ctx := context.Background()
+
+	cases := []struct {
+		name      string
+		status    int
+		header    map[string]string
+		body      string
+		wantCalls int64
+		wantClass ErrorClass
+	}{
+		{"not found is terminal", 200, nil, `{"data":{"user":{}}}`, 1, ErrorClassNotFound},
+		{"validation is terminal", 200, nil, `{"errors":[{"message":"bad","kind":"Validation","code":336}]}`, 1, ErrorClassValidation},
+		{"auth retries once", 401, nil, `denied`, 2, ErrorClassAuth},
+		{"client error is terminal", 400, nil, `bad`, 1, ErrorClassClient},
+		{"malformed response is terminal", 200, nil, `not json`, 1, ErrorClassUnknown},
+		{"server error retries", 503, nil, `down`, 4, ErrorClassServer},
+		{"retry-after beyond budget stops", 503, map[string]string{"Retry-After": "3600"}, `down`, 1, ErrorClassServer},
+	}
+
+	for _, tc := range cases {
+		server.graphqlCalls.Store(0)
+		server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range tc.header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(tc.status)
+			fmt.Fprint(w, tc.body)
+		})
+
+		_, err := client.User(ctx, "nasa")
+		if err == nil {
+			t.Errorf("%s: expected error", tc.name)
+			continue
+		}
+		if got := ClassifyError(err); got != tc.wantClass {
+			t.Errorf("%s: classified as %s, want %s", tc.name, got, tc.wantClass)
+		}
+		if got := server.graphqlCalls.Load(); got != tc.wantCalls {
+			t.Errorf("%s: %d calls, want %d", tc.name, got, tc.wantCalls)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+
+	policy := &RetryPolicy{Jitter: JitterNone, MaxDelay: time.Second}
+	if got := policy.backoff(base, 2, 3, 0); got != 400*time.Millisecond {
+		t.Errorf("Exponential backoff = %v, want 400ms", got)
+	}
+	if got := policy.backoff(base, 2, 10, 0); got != time.Second {
+		t.Errorf("Backoff should be capped at MaxDelay, got %v", got)
+	}
+
+	policy.Jitter = JitterFull
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(base, 2, 3, 0); got < 0 || got > 400*time.Millisecond {
+			t.Fatalf("Full jitter out of range: %v", got)
+		}
+	}
+
+	policy.Jitter = JitterDecorrelated
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(base, 2, 3, 200*time.Millisecond); got < base || got > 600*time.Millisecond {
+			t.Fatalf("Decorrelated jitter out of range: %v", got)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	server := newStandIn(t)
+	var healthy atomic.Bool
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	config := server.config()
+	config.EnableAutoRetry = false
+	config.CircuitBreaker = &CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond, HalfOpenProbes: 1}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.User(ctx, "nasa"); errors.Is(err, ErrCircuitOpen) || err == nil {
+			t.Fatalf("Expected server error before the circuit opens, got %v", err)
+		}
+	}
+
+	_, err = client.User(ctx, "nasa")
+	var openErr *CircuitOpenError
+	if !errors.Is(err, ErrCircuitOpen) || !errors.As(err, &openErr) || openErr.Operation != "UserByScreenName" {
+		t.Fatalf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if stats := client.IdentityStats(); stats[0].Requests != 2 {
+		t.Errorf("Requests rejected by the breaker should not be counted, got %d", stats[0].Requests)
+	}
+	if server.graphqlCalls.Load() != 2 {
+		t.Errorf("Open circuit should not reach the server, got %d calls", server.graphqlCalls.Load())
+	}
+
+	metrics := client.GetMetrics()
+	if len(metrics.CircuitBreakers) != 1 || metrics.CircuitBreakers[0].State != CircuitOpen || metrics.CircuitBreakers[0].Rejections != 1 {
+		t.Fatalf("Unexpected breaker metrics: %+v", metrics.CircuitBreakers)
+	}
+
+	// After the open timeout a successful probe closes the circuit
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.User(ctx, "nasa"); err != nil {
+		t.Fatalf("Probe request should succeed: %v", err)
+	}
+	if state := client.GetMetrics().CircuitBreakers[0].State; state != CircuitClosed {
+		t.Errorf("Circuit should be closed after a successful probe, got %s", state)
+	}
+}
+
+func TestGuestTokenActivation(t *testing.T) {
+	server := newStandIn(t)
+
+	// The first token is rejected once as expired; every request must carry the current token
+	var seen []string
+	var mu sync.Mutex
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-Guest-Token")
+		cookie, err := r.Cookie("gt")
+		if err != nil || cookie.Value != token {
+			t.Errorf("gt cookie should match x-guest-token, got %v / %q", cookie, token)
+		}
+		mu.Lock()
+		seen = append(seen, token)
+		mu.Unlock()
+
+		if token == "gt-1" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":[{"code":239,"message":"Bad guest token."}]}`)
+			return
+		}
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	config := server.config()
+	config.EnableAutoRetry = false
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if server.activations.Load() != 0 {
+		t.Error("Guest activation should be deferred to the first request")
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := client.User(ctx, "nasa"); err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+	}
+
+	if got := server.activations.Load(); got != 2 {
+		t.Errorf("Expected 2 activations (initial + re-activation), got %d", got)
+	}
+	if strings.Join(seen, ",") != "gt-1,gt-2,gt-2" {
+		t.Errorf("Unexpected guest token sequence: %v", seen)
+	}
+}
+
+func TestSessionMode(t *testing.T) {
+	server := newStandIn(t)
+
+	var calls atomic.Int64
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		ct0, _ := r.Cookie("ct0")
+		auth, _ := r.Cookie("auth_token")
+		if auth == nil || auth.Value != "secret" || ct0 == nil || ct0.Value != r.Header.Get("X-Csrf-Token") {
+			t.Errorf("Session cookies and CSRF header should match, got %v / %q", ct0, r.Header.Get("X-Csrf-Token"))
+		}
+		if r.Header.Get("X-Twitter-Auth-Type") != "OAuth2Session" || r.Header.Get("X-Guest-Token") != "" {
+			t.Error("Session requests should use OAuth2Session auth without a guest token")
+		}
+
+		// The first response rotates ct0 and rejects the stale token
+		if calls.Add(1) == 1 {
+			http.SetCookie(w, &http.Cookie{Name: "ct0", Value: "rotated"})
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":[{"code":353,"message":"This request requires a matching csrf cookie and header."}]}`)
+			return
+		}
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	config := server.config()
+	config.EnableAutoRetry = false
+	config.Session = &Session{AuthToken: "secret", CSRFToken: "original", TwID: "u%3D12345"}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	if _, err := client.User(context.Background(), "nasa"); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+
+	session := client.Session()
+	if session.CSRFToken != "rotated" || config.Session.CSRFToken != "original" {
+		t.Errorf("ct0 should rotate on the client's copy only, got %q / %q", session.CSRFToken, config.Session.CSRFToken)
+	}
+	if session.UserID() != "12345" || client.identities.primary().name() != "user:12345" {
+		t.Errorf("Unexpected session identity %q", client.identities.primary().name())
+	}
+	if server.activations.Load() != 0 {
+		t.Error("Session mode should not activate guest tokens")
+	}
+
+	if err := client.SetSession(&Session{AuthToken: "x"}); err == nil {
+		t.Error("Session without ct0 should be rejected")
+	}
+}
+
+func TestIdentityPool(t *testing.T) {
+	server := newStandIn(t)
+
+	// The session is revoked and the first guest token is rate limited
+	var mu sync.Mutex
+	used := make(map[string]int)
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		guestID, _ := r.Cookie("guest_id")
+		mu.Lock()
+		used[guestID.Value]++
+		mu.Unlock()
+
+		if auth, err := r.Cookie("auth_token"); err == nil && auth.Value == "revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errors":[{"code":32,"message":"Could not authenticate you."}]}`)
+			return
+		}
+		if r.Header.Get("X-Guest-Token") == "gt-1" {
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	config := server.config()
+	config.EnableAutoRetry = false
+	config.Identities = &IdentityPoolConfig{
+		Sessions: []*Session{{AuthToken: "revoked", CSRFToken: "ct0", TwID: "u%3D777"}},
+		Guests:   2,
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	var authErr *AuthError
+	if _, err := client.User(ctx, "nasa"); !errors.As(err, &authErr) {
+		t.Fatalf("Expected the session to be rejected first, got %v", err)
+	}
+	var rateErr *RateLimitError
+	if _, err := client.User(ctx, "nasa"); !errors.As(err, &rateErr) {
+		t.Fatalf("Expected the first guest to be rate limited, got %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := client.User(ctx, "nasa"); err != nil {
+			t.Fatalf("Healthy guest should serve request %d: %v", i, err)
+		}
+	}
+
+	if len(used) != 3 {
+		t.Errorf("Expected 3 distinct identities on the wire, got %v", used)
+	}
+
+	stats := client.GetMetrics().Identities
+	if len(stats) != 3 {
+		t.Fatalf("Expected 3 identity stats, got %+v", stats)
+	}
+	byName := make(map[string]IdentityStats)
+	for _, s := range stats {
+		byName[s.Name] = s
+	}
+
+	now := time.Now()
+	session := byName["user:777"]
+	if session.Kind != IdentitySession || session.AuthFailures != 1 || !session.Benched(now) {
+		t.Errorf("Session should be benched after a 401: %+v", session)
+	}
+	if stats[0].Successes != 4 || stats[0].Health != 1 || stats[0].Benched(now) {
+		t.Errorf("Healthy guest should rank first: %+v", stats[0])
+	}
+	var limited int
+	for _, s := range stats {
+		if s.Kind == IdentityGuest && s.RateLimited == 1 && s.Benched(now) && s.RateLimits["UserByScreenName"].Remaining == 0 {
+			limited++
+		}
+	}
+	if limited != 1 {
+		t.Errorf("Expected one benched, rate limited guest: %+v", stats)
+	}
+
+	config.Identities = &IdentityPoolConfig{Sessions: []*Session{{AuthToken: "x"}}}
+	if _, err := NewClient(config); err == nil {
+		t.Error("Invalid pooled session should be rejected")
+	}
+}
+
+// forwardProxy is an HTTP proxy in front of the stand-in that records which
+// guest IDs it carried and can be switched to fail GraphQL requests
+type forwardProxy struct {
+	*httptest.Server
+	failing  atomic.Bool
+	mu       sync.Mutex
+	guestIDs map[string]bool
+}
+
+func newForwardProxy(t *testing.T, upstream *standIn) *forwardProxy {
+	t.Helper()
+
+	p := &forwardProxy{guestIDs: make(map[string]bool)}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.URL.IsAbs() {
+			http.Error(w, "not a proxy request", http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/graphql/") {
+			guestID, _ := r.Cookie("guest_id")
+			p.mu.Lock()
+			p.guestIDs[guestID.Value] = true
+			p.mu.Unlock()
+			if p.failing.Load() {
+				http.Error(w, "upstream connect error", http.StatusBadGateway)
+				return
+			}
+		}
+		upstream.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *forwardProxy) carried(guestID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.guestIDs[guestID]
+}
+
+func TestProxyPool(t *testing.T) {
+	server := newStandIn(t)
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+	proxies := []*forwardProxy{newForwardProxy(t, server), newForwardProxy(t, server)}
+
+	config := server.config()
+	config.EnableAutoRetry = false
+	config.Identities = &IdentityPoolConfig{Guests: 1}
+	config.ProxyPool = &ProxyPool{
+		URLs:        []string{proxies[0].URL, proxies[1].URL},
+		MaxFailures: 1,
+	}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := client.User(ctx, "nasa"); err != nil {
+		t.Fatalf("Failed to get user: %v", err)
+	}
+	firstGuest := client.identities.primary().name()
+	pinned, other := proxies[0], proxies[1]
+	if !pinned.carried(firstGuest) {
+		pinned, other = other, pinned
+	}
+
+	// The pinned proxy starts failing: it is quarantined and the guest moves with a new guest ID
+	pinned.failing.Store(true)
+	if _, err := client.User(ctx, "nasa"); err == nil {
+		t.Fatal("Expected the failing proxy to surface an error")
+	}
+	if _, err := client.User(ctx, "nasa"); err != nil {
+		t.Fatalf("Request should move to the healthy proxy: %v", err)
+	}
+
+	secondGuest := client.identities.primary().name()
+	if secondGuest == firstGuest {
+		t.Error("Guest should get a new guest ID when moving proxies")
+	}
+	if other.carried(firstGuest) || pinned.carried(secondGuest) || !other.carried(secondGuest) {
+		t.Error("Each guest ID should only be seen through its own proxy")
+	}
+	if server.activations.Load() != 2 {
+		t.Errorf("Moved guest should activate a new token, got %d activations", server.activations.Load())
+	}
+
+	now := time.Now()
+	stats := client.GetMetrics().Proxies
+	byURL := map[string]ProxyStats{stats[0].URL: stats[0], stats[1].URL: stats[1]}
+	bad, good := byURL[pinned.URL], byURL[other.URL]
+	if !bad.Quarantined(now) || bad.Quarantines != 1 || bad.Identities != 0 || bad.SuccessRate >= 100 {
+		t.Errorf("Failing proxy should be quarantined: %+v", bad)
+	}
+	if good.Quarantined(now) || good.Identities != 1 || good.SuccessRate != 100 {
+		t.Errorf("Healthy proxy should carry the guest: %+v", good)
+	}
+
+	config.ProxyPool = &ProxyPool{URLs: []string{"ftp://proxy.example.com"}}
+	if _, err := NewClient(config); err == nil {
+		t.Error("Unsupported proxy scheme should be rejected")
+	}
+}
+
+func TestLazyInitialization(t *testing.T) {
+	server := newStandIn(t)
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	config := server.config()
+	config.LazyInitialization = true
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	if server.homeFetches.Load() != 0 {
+		t.Error("Lazy client should not fetch key material at construction")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.User(context.Background(), "nasa"); err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+	}
+	if server.homeFetches.Load() != 1 {
+		t.Errorf("Key material should be fetched once on first use, got %d", server.homeFetches.Load())
+	}
+
+	// Offline construction succeeds; the first request reports the missing key material
+	offline := newStandIn(t)
+	offline.Close()
+	config = offline.config()
+	config.LazyInitialization = true
+	config.EnableAutoRetry = false
+	client, err = NewClient(config)
+	if err != nil {
+		t.Fatalf("Lazy client should construct offline: %v", err)
+	}
+	if _, err := client.User(context.Background(), "nasa"); err == nil {
+		t.Error("Expected the first request to fail offline")
+	}
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	// A homepage that never answers until the request is cancelled
+	entered := make(chan struct{}, 1)
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1.1/guest/activate.json" {
+			fmt.Fprint(w, `{"guest_token":"gt-1"}`)
+			return
+		}
+		select {
+		case entered <- struct{}{}:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	config := DefaultProductionConfig()
+	config.Endpoints = EndpointsFor(hung.URL)
+	config.EnableAutoRetry = false
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := NewClientContext(ctx, config); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected construction to honor the context deadline, got %v", err)
+	}
+	<-entered
+
+	// Close aborts a lazy refresh that is already in flight
+	config.LazyInitialization = true
+	client, err := NewClientContext(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.User(context.Background(), "nasa")
+		done <- err
+	}()
+
+	<-entered
+	client.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected the refresh to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not cancel the in-flight refresh")
+	}
+}
@@ -0,0 +1,119 @@
+// Command xapi-txid decodes X-Client-Transaction-Id values and checks them
+// against a request, to tell a malformed transaction ID from other causes of
+// a rejected request.
+//
+// Usage:
+//
+//	xapi-txid [flags] <transaction-id>...
+//
+// Without key material flags only the breakdown is printed. With -live, or
+// -home and -ondemand pointing at saved sources, the key bytes and hash are
+// verified against -method and -path. -animation-key verifies the hash alone.
+//
+// Example:
+//
+//	xapi-txid -live -method GET -path /i/api/graphql/abc/UserByScreenName 'AAswVXqf...'
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Davincible/xapi"
+)
+
+func main() {
+	keyLen := flag.Int("keylen", 48, "verification key length in bytes")
+	method := flag.String("method", "GET", "request method the ID was generated for")
+	path := flag.String("path", "", "request path the ID was generated for")
+	animationKey := flag.String("animation-key", "", "animation key to verify the hash with")
+	homeFile := flag.String("home", "", "saved homepage HTML to derive key material from")
+	onDemandFile := flag.String("ondemand", "", "saved ondemand.s JavaScript to derive key material from")
+	live := flag.Bool("live", false, "fetch the current key material from x.com")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <transaction-id>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	tg, err := generator(*live, *homeFile, *onDemandFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xapi-txid: %v\n", err)
+		os.Exit(1)
+	}
+	if tg != nil {
+		defer tg.Close()
+		fmt.Printf("key material: %d-byte key, animation key %s\n\n", tg.GetStats().KeyLength, tg.GetStats().AnimationKey)
+	}
+
+	failed := false
+	for _, id := range flag.Args() {
+		if !inspect(tg, id, *keyLen, *method, *path, *animationKey) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// generator returns the key material source selected by the flags, or nil for decoding only
+func generator(live bool, homeFile, onDemandFile string) (*xapi.TransactionGenerator, error) {
+	switch {
+	case live:
+		return xapi.NewTransactionGenerator()
+	case homeFile != "" || onDemandFile != "":
+		if homeFile == "" || onDemandFile == "" {
+			return nil, errors.New("-home and -ondemand must be given together")
+		}
+		homeHTML, err := os.ReadFile(homeFile)
+		if err != nil {
+			return nil, err
+		}
+		onDemandJS, err := os.ReadFile(onDemandFile)
+		if err != nil {
+			return nil, err
+		}
+		return xapi.NewTransactionGeneratorFromSources(string(homeHTML), string(onDemandJS))
+	default:
+		return nil, nil
+	}
+}
+
+// inspect prints the breakdown of one ID and whether it verifies
+func inspect(tg *xapi.TransactionGenerator, id string, keyLen int, method, path, animationKey string) bool {
+	fmt.Println(id)
+
+	var decoded *xapi.DecodedTransactionID
+	var err error
+	switch {
+	case tg != nil:
+		decoded, err = tg.InspectTransactionID(id, method, path)
+	default:
+		decoded, err = xapi.DecodeTransactionID(id, keyLen)
+		if err == nil && animationKey != "" {
+			err = decoded.Verify(method, path, animationKey)
+		}
+	}
+
+	if decoded != nil {
+		fmt.Println(decoded)
+	}
+	switch {
+	case err != nil:
+		fmt.Printf("result:    %v\n\n", err)
+		return false
+	case tg != nil || animationKey != "":
+		fmt.Printf("result:    ok for %s %s\n\n", method, path)
+	default:
+		fmt.Printf("result:    decoded (no key material to verify against)\n\n")
+	}
+	return true
+}
@@ -1,6 +1,13 @@
 package xapi
 
-import "time"
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
 
 // ProductionConfig holds production-optimized configuration
 type ProductionConfig struct {
@@ -14,17 +21,223 @@ type ProductionConfig struct {
 	MaxRetryAttempts         int           // Maximum retry attempts per request
 	RetryBackoffBase         time.Duration // Base backoff duration between retries
 	RetryBackoffMultiplier   float64       // Backoff multiplier for exponential backoff
+	RetryPolicy              *RetryPolicy  // Error classification, jitter and retry budget (nil uses DefaultRetryPolicy)
+	
+	// Deferred startup - fetch key material on the first request instead of in NewClient
+	LazyInitialization       bool          // Skip the blocking homepage fetch at construction
+	KeyMaterialStore         KeyMaterialStore // Persisted key material for warm starts (nil always fetches)
+	
+	// Background refresh - renew key material before it expires instead of on a request
+	BackgroundRefresh        bool          // Refresh ahead of expiry in a goroutine, serving stale material meanwhile
+	RefreshAhead             time.Duration // How long before expiry the background refresh runs
+	
+	// Transaction ID inputs - nil uses the system clock and crypto/rand
+	Clock                    Clock         // Time embedded in transaction IDs and used for key material expiry
+	Random                   io.Reader     // Source of the XOR byte; must be safe for concurrent use
+	
+	// Key material extraction - strategies tried in order (nil uses DefaultExtractors)
+	Extractors               []Extractor
+	OnDrift                  func(DriftEvent) // Called in its own goroutine when a refresh changes the key material's shape
 	
 	// Error threshold for cache invalidation
 	ErrorThresholdForRefresh int           // Number of errors before forcing refresh
 	
+	// Circuit breaker per operation and identity (nil uses DefaultCircuitBreakerConfig)
+	CircuitBreaker           *CircuitBreakerConfig
+	
 	// Request timing and rate limiting
 	RequestTimeout           time.Duration // Timeout for individual requests
 	RateLimitRequests        float64       // Requests per second
+	MaxRateLimitWait         time.Duration // Longest wait for an exhausted operation to reset before failing
 	
 	// Debug and monitoring
 	EnableDebugLogging       bool          // Enable detailed debug logs
 	EnableMetrics           bool          // Enable performance metrics
+	
+	// Outbound hosts - nil uses the live x.com hosts
+	Endpoints                *Endpoints    // Base URLs for API, homepage and asset requests
+	
+	// GraphQL operations - nil gives each client its own registry of DefaultOperations
+	Operations               *OperationRegistry // Query IDs, features and field toggles; may be shared
+	
+	// Browser fingerprint - nil uses the "firefox-linux" built-in profile
+	BrowserProfile           *BrowserProfile // Headers and XPFF navigator properties of identities without their own profile
+	
+	// Logged-in session - nil sends anonymous guest requests
+	Session                  *Session      // auth_token / ct0 cookies of an account
+	
+	// Identity pool - nil sends every request as Session or a single guest
+	Identities               *IdentityPoolConfig // Extra sessions and guests to rotate across
+	
+	// Egress proxies - nil connects directly
+	ProxyPool                *ProxyPool    // HTTP/SOCKS5 proxies identities are pinned to
+	
+	// HTTP transport shared by the client and transaction generator
+	HTTPClient               *http.Client      // Full HTTP client (takes precedence over Transport)
+	Transport                http.RoundTripper // Custom transport for proxies, TLS, pooling or test doubles
+}
+
+// Endpoints holds the base URLs for every host the client talks to.
+//
+// Pointing these at a local stand-in (an httptest server, a corporate mirror
+// or a recording proxy) lets the client and transaction generator run without
+// access to the live site.
+type Endpoints struct {
+	API    string // GraphQL and REST API host (https://api.x.com)
+	Web    string // Homepage host used for key material (https://x.com)
+	Assets string // Static JS bundle host (https://abs.twimg.com)
+}
+
+// DefaultEndpoints returns the live x.com hosts
+func DefaultEndpoints() *Endpoints {
+	return &Endpoints{
+		API:    "https://api.x.com",
+		Web:    "https://x.com",
+		Assets: "https://abs.twimg.com",
+	}
+}
+
+// EndpointsFor points every host at a single base URL, which is convenient
+// for tests that serve the API, homepage and bundles from one server.
+//
+// Example:
+//
+//	server := httptest.NewServer(handler)
+//	config := xapi.DefaultProductionConfig()
+//	config.Endpoints = xapi.EndpointsFor(server.URL)
+func EndpointsFor(baseURL string) *Endpoints {
+	return &Endpoints{
+		API:    baseURL,
+		Web:    baseURL,
+		Assets: baseURL,
+	}
+}
+
+// GraphQLURL returns the URL for a GraphQL operation ("<queryID>/<name>")
+func (e *Endpoints) GraphQLURL(operation string) string {
+	return e.APIURL("graphql/" + operation)
+}
+
+// APIURL returns the URL for a path on the API host
+func (e *Endpoints) APIURL(path string) string {
+	return joinURL(e.API, path)
+}
+
+// HomeURL returns the homepage URL that carries the transaction key material
+func (e *Endpoints) HomeURL() string {
+	return strings.TrimRight(e.Web, "/")
+}
+
+// OnDemandURL returns the URL of the ondemand.s bundle for the given hash
+func (e *Endpoints) OnDemandURL(hash string) string {
+	return e.BundleURL("ondemand.s", hash)
+}
+
+// BundleURL returns the URL of a web app chunk, such as "api", for the hash
+// the homepage lists it with
+func (e *Endpoints) BundleURL(chunk, hash string) string {
+	return e.AssetURL(fmt.Sprintf("responsive-web/client-web/%s.%sa.js", chunk, hash))
+}
+
+// AssetURL returns the URL for a path on the static asset host
+func (e *Endpoints) AssetURL(path string) string {
+	return joinURL(e.Assets, path)
+}
+
+// joinURL joins a base URL and a path with exactly one slash
+func joinURL(base, path string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// httpClient returns the HTTP client used for outbound requests that belong
+// to no identity, and the proxy set behind it when a ProxyPool is configured
+func (c *ProductionConfig) httpClient() (*http.Client, *proxySet, error) {
+	base := c.baseHTTPClient()
+	proxies, err := newProxySet(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if proxies != nil {
+		return proxies.client(base), proxies, nil
+	}
+	return base, nil, nil
+}
+
+// baseHTTPClient returns the HTTP client before proxies are applied.
+// A configured HTTPClient is used as-is; otherwise a client is built around
+// Transport (or http.DefaultTransport) with RequestTimeout applied.
+func (c *ProductionConfig) baseHTTPClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return &http.Client{
+		Timeout:   c.RequestTimeout,
+		Transport: c.Transport,
+	}
+}
+
+// retryPolicy returns the configured retry policy, falling back to the default
+func (c *ProductionConfig) retryPolicy() *RetryPolicy {
+	if c.RetryPolicy == nil {
+		return DefaultRetryPolicy()
+	}
+	return c.RetryPolicy
+}
+
+// clock returns the configured clock, falling back to the system clock
+func (c *ProductionConfig) clock() Clock {
+	if c.Clock == nil {
+		return ClockFunc(time.Now)
+	}
+	return c.Clock
+}
+
+// random returns the configured random source, falling back to crypto/rand
+func (c *ProductionConfig) random() io.Reader {
+	if c.Random == nil {
+		return rand.Reader
+	}
+	return c.Random
+}
+
+// browserProfile returns the configured browser profile, falling back to the default
+func (c *ProductionConfig) browserProfile() *BrowserProfile {
+	if c == nil || c.BrowserProfile == nil {
+		return defaultBrowserProfile
+	}
+	return c.BrowserProfile
+}
+
+// operations returns the configured operation registry, or a new one
+func (c *ProductionConfig) operations() *OperationRegistry {
+	if c.Operations == nil {
+		return NewOperationRegistry()
+	}
+	return c.Operations
+}
+
+// extractors returns the configured extractor chain, falling back to the built-in strategies
+func (c *ProductionConfig) extractors() []Extractor {
+	if len(c.Extractors) == 0 {
+		return DefaultExtractors()
+	}
+	return c.Extractors
+}
+
+// circuitBreaker returns the configured circuit breaker settings, falling back to the default
+func (c *ProductionConfig) circuitBreaker() *CircuitBreakerConfig {
+	if c.CircuitBreaker == nil {
+		return DefaultCircuitBreakerConfig()
+	}
+	return c.CircuitBreaker
+}
+
+// endpoints returns the configured endpoints, falling back to the live hosts
+func (c *ProductionConfig) endpoints() *Endpoints {
+	if c == nil || c.Endpoints == nil {
+		return DefaultEndpoints()
+	}
+	return c.Endpoints
 }
 
 // DefaultProductionConfig returns optimized settings for production use
@@ -40,13 +253,20 @@ func DefaultProductionConfig() *ProductionConfig {
 		MaxRetryAttempts:         3,                 // Up to 3 retries per request
 		RetryBackoffBase:         500 * time.Millisecond, // Start with 500ms backoff
 		RetryBackoffMultiplier:   2.0,               // Exponential backoff: 500ms, 1s, 2s
+		RetryPolicy:              DefaultRetryPolicy(), // Full jitter, 2 minute budget per call
+		
+		// Refresh key material in the background, well before it expires
+		BackgroundRefresh:        true,
+		RefreshAhead:             10 * time.Minute,  // Renew 10 minutes before expiry
 		
 		// Conservative error handling
 		ErrorThresholdForRefresh: 2,                 // Refresh after 2 consecutive errors
+		CircuitBreaker:           DefaultCircuitBreakerConfig(), // Open after 5 failures, probe after 30s
 		
 		// Reasonable timeouts
 		RequestTimeout:           30 * time.Second,   // 30s timeout per request
 		RateLimitRequests:        50.0 / 60.0,       // 50 requests per minute
+		MaxRateLimitWait:         15 * time.Minute,  // Wait out a full rate limit window
 		
 		// Production logging
 		EnableDebugLogging:       false,             // Disable debug in production
@@ -67,13 +287,24 @@ func DevelopmentConfig() *ProductionConfig {
 		MaxRetryAttempts:         2,                 // Fewer retries for faster feedback
 		RetryBackoffBase:         200 * time.Millisecond,
 		RetryBackoffMultiplier:   1.5,
+		RetryPolicy:              DefaultRetryPolicy(),
+		
+		// Background refresh with a shorter lead for the short lifetimes
+		BackgroundRefresh:        true,
+		RefreshAhead:             2 * time.Minute,
 		
 		// Sensitive error handling
 		ErrorThresholdForRefresh: 1,                 // Refresh after 1 error in dev
+		CircuitBreaker: &CircuitBreakerConfig{
+			FailureThreshold: 3,                 // Trip quickly to surface problems
+			OpenTimeout:      10 * time.Second,
+			HalfOpenProbes:   1,
+		},
 		
 		// Shorter timeouts for faster iteration
 		RequestTimeout:           15 * time.Second,
 		RateLimitRequests:        100.0 / 60.0,      // Higher rate limit for testing
+		MaxRateLimitWait:         1 * time.Minute,   // Fail fast on long rate limit pauses
 		
 		// Full logging in development
 		EnableDebugLogging:       true,
@@ -95,12 +326,17 @@ func UltraFreshConfig() *ProductionConfig {
 		RetryBackoffBase:         0,
 		RetryBackoffMultiplier:   1.0,
 		
+		// Refresh inline on every request - nothing to renew ahead of
+		BackgroundRefresh:        false,
+		
 		// Immediate refresh on any error
 		ErrorThresholdForRefresh: 1,
+		CircuitBreaker:           &CircuitBreakerConfig{}, // Disabled - see every raw failure
 		
 		// Standard timeouts
 		RequestTimeout:           10 * time.Second,
 		RateLimitRequests:        30.0 / 60.0,
+		MaxRateLimitWait:         0,                 // Never wait - surface rate limits immediately
 		
 		// Full debugging for ultra-fresh testing
 		EnableDebugLogging:       true,
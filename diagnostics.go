@@ -0,0 +1,248 @@
+package xapi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Number of refreshes and animation key changes remembered for Diagnose
+const diagnosticsHistory = 20
+
+// onDemandHashRegex finds the ondemand.s chunk hash in the homepage script map
+var onDemandHashRegex = regexp.MustCompile(`['\"]{1}ondemand\.s['\"]{1}:\s*['\"]{1}([\w]*)['\"]{1}`)
+
+// onDemandHash returns the ondemand.s chunk hash referenced by the homepage, or ""
+func onDemandHash(homeHTML string) string {
+	matches := onDemandHashRegex.FindStringSubmatch(homeHTML)
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// Diagnostics describes the shape of the current key material against what
+// earlier refreshes looked like. A frontend change on x.com usually shows up
+// here, as a new index count, a padded or missing frame row or a fallback
+// extractor, before transaction IDs start getting rejected.
+type Diagnostics struct {
+	Time         time.Time `json:"time"`
+	OnDemandURL  string    `json:"ondemand_url"`
+	OnDemandHash string    `json:"ondemand_hash"` // Chunk hash from the homepage script map
+	KeyLength    int       `json:"key_length"`
+	IndexCount   int       `json:"index_count"` // Key byte indices, not counting the row index
+	AnimationKey string    `json:"animation_key"`
+
+	// Most common values over the last refreshes
+	TypicalKeyLength  int `json:"typical_key_length"`
+	TypicalIndexCount int `json:"typical_index_count"`
+	RefreshesObserved int `json:"refreshes_observed"`
+
+	// Frame row fed to the animation. The frame fields are zero after a warm
+	// start, as persisted key material does not keep the frames.
+	FrameIndex       int  `json:"frame_index"`        // loading-x-anim-<n>
+	FrameRow         int  `json:"frame_row"`          // Row selected by the row index
+	FrameRowLength   int  `json:"frame_row_length"`   // Values in the row before padding
+	FrameRowPadded   bool `json:"frame_row_padded"`   // animate padded the row to 15 values
+	FrameRowFallback bool `json:"frame_row_fallback"` // The selected row did not exist; frames[0] was used
+
+	Extraction          *ExtractionReport    `json:"extraction,omitempty"`
+	AnimationKeyChanges []AnimationKeyChange `json:"animation_key_changes"` // Oldest first
+	Warnings            []string             `json:"warnings,omitempty"`    // Deviations worth a look
+}
+
+// AnimationKeyChange records a refresh that produced a new animation key
+type AnimationKeyChange struct {
+	Time         time.Time `json:"time"`
+	AnimationKey string    `json:"animation_key"`
+	OnDemandHash string    `json:"ondemand_hash"`
+}
+
+// InvariantChange is one invariant that differs between two refreshes
+type InvariantChange struct {
+	Name     string `json:"name"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// DriftEvent is passed to ProductionConfig.OnDrift when a refresh publishes
+// key material whose shape differs from the previous key material
+type DriftEvent struct {
+	Time        time.Time         `json:"time"`
+	Changes     []InvariantChange `json:"changes"`
+	Diagnostics *Diagnostics      `json:"diagnostics"`
+}
+
+// keyFacts are the invariants of one snapshot that drift detection compares
+type keyFacts struct {
+	onDemandHash     string
+	keyLength        int
+	indexCount       int
+	frameRowLength   int // 0 when unknown (warm start)
+	frameRowFallback bool
+	indicesBy        string // "" when unknown (warm start)
+	framesBy         string
+}
+
+func (s *keySnapshot) facts() keyFacts {
+	return keyFacts{
+		onDemandHash:     s.onDemandHash,
+		keyLength:        len(s.keyBytes),
+		indexCount:       len(s.keyBytesIndices),
+		frameRowLength:   s.frameRowLength,
+		frameRowFallback: s.frameRowFallback,
+		indicesBy:        s.report.Indices,
+		framesBy:         s.report.Frames,
+	}
+}
+
+// changesFrom lists the invariants that differ from an earlier snapshot.
+// Facts unknown on either side are not compared.
+func (f keyFacts) changesFrom(prev keyFacts) []InvariantChange {
+	var changes []InvariantChange
+	add := func(name, previous, current string) {
+		if previous != current {
+			changes = append(changes, InvariantChange{Name: name, Previous: previous, Current: current})
+		}
+	}
+
+	if prev.onDemandHash != "" && f.onDemandHash != "" {
+		add("ondemand_hash", prev.onDemandHash, f.onDemandHash)
+	}
+	add("key_length", strconv.Itoa(prev.keyLength), strconv.Itoa(f.keyLength))
+	add("index_count", strconv.Itoa(prev.indexCount), strconv.Itoa(f.indexCount))
+	if prev.frameRowLength > 0 && f.frameRowLength > 0 {
+		add("frame_row_padded", strconv.FormatBool(prev.frameRowLength < animationRowLength),
+			strconv.FormatBool(f.frameRowLength < animationRowLength))
+		add("frame_row_fallback", strconv.FormatBool(prev.frameRowFallback), strconv.FormatBool(f.frameRowFallback))
+	}
+	if prev.indicesBy != "" && f.indicesBy != "" {
+		add("indices_extractor", prev.indicesBy, f.indicesBy)
+		add("frames_extractor", prev.framesBy, f.framesBy)
+	}
+	return changes
+}
+
+// observe records a newly published snapshot in the history and reports
+// drift from the previous one. The caller must hold refreshMutex.
+func (tg *TransactionGenerator) observe(previous, current *keySnapshot) {
+	facts := current.facts()
+
+	tg.mu.Lock()
+	tg.factHistory = appendBounded(tg.factHistory, facts)
+	if previous == nil || previous.animationKey != current.animationKey {
+		tg.keyChanges = appendBounded(tg.keyChanges, AnimationKeyChange{
+			Time:         current.fetchedAt,
+			AnimationKey: current.animationKey,
+			OnDemandHash: current.onDemandHash,
+		})
+	}
+	tg.mu.Unlock()
+
+	hook := tg.config.OnDrift
+	if previous == nil || hook == nil {
+		return
+	}
+	changes := facts.changesFrom(previous.facts())
+	if len(changes) == 0 {
+		return
+	}
+
+	event := DriftEvent{Time: time.Now(), Changes: changes, Diagnostics: tg.Diagnose()}
+	if tg.config.EnableDebugLogging {
+		fmt.Printf("⚠️ Key material drift: %v\n", changes)
+	}
+	// Run outside refreshMutex so the hook may refresh or inspect the generator
+	go hook(event)
+}
+
+// appendBounded appends v and keeps the last diagnosticsHistory entries
+func appendBounded[T any](history []T, v T) []T {
+	history = append(history, v)
+	if len(history) > diagnosticsHistory {
+		history = append(history[:0:0], history[len(history)-diagnosticsHistory:]...)
+	}
+	return history
+}
+
+// Diagnose reports the shape of the current key material against the norms
+// of earlier refreshes, with warnings for anything unusual. It returns nil
+// before the first key material is available.
+//
+// Example:
+//
+//	if d := tg.Diagnose(); len(d.Warnings) > 0 {
+//	    log.Printf("transaction key material looks off: %v", d.Warnings)
+//	}
+func (tg *TransactionGenerator) Diagnose() *Diagnostics {
+	snapshot := tg.snapshot.Load()
+	if snapshot == nil {
+		return nil
+	}
+
+	d := &Diagnostics{
+		Time:             time.Now(),
+		OnDemandHash:     snapshot.onDemandHash,
+		KeyLength:        len(snapshot.keyBytes),
+		IndexCount:       len(snapshot.keyBytesIndices),
+		AnimationKey:     snapshot.animationKey,
+		FrameIndex:       snapshot.frameIndex,
+		FrameRow:         snapshot.frameRow,
+		FrameRowLength:   snapshot.frameRowLength,
+		FrameRowPadded:   snapshot.frameRowLength > 0 && snapshot.frameRowLength < animationRowLength,
+		FrameRowFallback: snapshot.frameRowFallback,
+		Extraction:       snapshot.extractionReport(),
+	}
+	if d.OnDemandHash != "" {
+		d.OnDemandURL = tg.config.endpoints().OnDemandURL(d.OnDemandHash)
+	}
+
+	tg.mu.RLock()
+	keyLengths := make([]int, len(tg.factHistory))
+	indexCounts := make([]int, len(tg.factHistory))
+	for i, facts := range tg.factHistory {
+		keyLengths[i] = facts.keyLength
+		indexCounts[i] = facts.indexCount
+	}
+	d.AnimationKeyChanges = append([]AnimationKeyChange(nil), tg.keyChanges...)
+	tg.mu.RUnlock()
+
+	d.RefreshesObserved = len(keyLengths)
+	d.TypicalKeyLength = mode(keyLengths)
+	d.TypicalIndexCount = mode(indexCounts)
+
+	if d.RefreshesObserved > 1 && d.KeyLength != d.TypicalKeyLength {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("key length %d differs from the usual %d", d.KeyLength, d.TypicalKeyLength))
+	}
+	if d.RefreshesObserved > 1 && d.IndexCount != d.TypicalIndexCount {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("index count %d differs from the usual %d", d.IndexCount, d.TypicalIndexCount))
+	}
+	if d.FrameRowPadded {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("frame row has %d values and was padded to %d", d.FrameRowLength, animationRowLength))
+	}
+	if d.FrameRowFallback {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("frame row %d does not exist; the first row was used", d.FrameRow))
+	}
+	if d.Extraction != nil && len(d.Extraction.Failures) > 0 {
+		d.Warnings = append(d.Warnings, fmt.Sprintf("extracted by fallback strategies (indices: %s, frames: %s)",
+			d.Extraction.Indices, d.Extraction.Frames))
+	}
+	if d.OnDemandHash == "" {
+		d.Warnings = append(d.Warnings, "no ondemand.s hash found in the homepage")
+	}
+	return d
+}
+
+// mode returns the most common value, preferring the most recent on a tie
+func mode(values []int) int {
+	counts := make(map[int]int)
+	best, bestCount := 0, 0
+	for i := len(values) - 1; i >= 0; i-- {
+		counts[values[i]]++
+		if counts[values[i]] > bestCount {
+			best, bestCount = values[i], counts[values[i]]
+		}
+	}
+	return best
+}
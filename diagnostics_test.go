@@ -0,0 +1,81 @@
+package xapi
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnose(t *testing.T) {
+	if (&TransactionGenerator{}).Diagnose() != nil {
+		t.Error("Diagnose without key material should return nil")
+	}
+
+	tg, err := NewTransactionGeneratorFromSources(fixtureHomeHTML(), fixtureOnDemandJS())
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	d := tg.Diagnose()
+	if d.OnDemandHash != fixtureOnDemandHash || !strings.Contains(d.OnDemandURL, fixtureOnDemandHash) {
+		t.Errorf("Unexpected ondemand file: %s %s", d.OnDemandHash, d.OnDemandURL)
+	}
+	if d.KeyLength != 48 || d.IndexCount != 3 || d.TypicalIndexCount != 3 || d.RefreshesObserved != 1 {
+		t.Errorf("Unexpected shape: %+v", d)
+	}
+	// The fixture rows have 11 values, so animate pads them
+	if d.FrameRowLength != 11 || !d.FrameRowPadded || d.FrameRowFallback || len(d.Warnings) != 1 {
+		t.Errorf("Unexpected frame row: %+v", d)
+	}
+	if len(d.AnimationKeyChanges) != 1 || d.AnimationKeyChanges[0].AnimationKey != d.AnimationKey {
+		t.Errorf("Expected the first animation key in the history, got %+v", d.AnimationKeyChanges)
+	}
+
+	drift := make(chan DriftEvent, 4)
+	tg.config.OnDrift = func(event DriftEvent) { drift <- event }
+
+	// Same shape: recorded, no drift and no new animation key
+	if err := tg.UpdateSources(fixtureHomeHTML(), fixtureOnDemandJS()); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// One index fewer, another key and pretty-printed frames
+	homeHTML := strings.ReplaceAll(fixtureHomeHTMLFor(fixtureKeyFor(91, 3), 101), `"><path`, "\">\n<path")
+	if err := tg.UpdateSources(homeHTML, fixtureOnDemandJSFor(2, 9, 17)); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	select {
+	case event := <-drift:
+		changes := make(map[string]InvariantChange)
+		for _, change := range event.Changes {
+			changes[change.Name] = change
+		}
+		if c := changes["index_count"]; c.Previous != "3" || c.Current != "2" {
+			t.Errorf("Expected an index count change, got %+v", event.Changes)
+		}
+		if c := changes["frames_extractor"]; c.Previous != ExtractorRegex || c.Current != ExtractorDOM {
+			t.Errorf("Expected a frames extractor change, got %+v", event.Changes)
+		}
+		if _, ok := changes["key_length"]; ok || event.Diagnostics == nil {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a drift event")
+	}
+	select {
+	case event := <-drift:
+		t.Errorf("Unexpected second drift event: %+v", event)
+	default:
+	}
+
+	d = tg.Diagnose()
+	if d.RefreshesObserved != 3 || d.TypicalIndexCount != 3 || len(d.AnimationKeyChanges) != 2 {
+		t.Errorf("Unexpected history: %+v", d)
+	}
+	warnings := strings.Join(d.Warnings, "\n")
+	if !strings.Contains(warnings, "index count 2 differs from the usual 3") || !strings.Contains(warnings, "fallback strategies") {
+		t.Errorf("Expected index count and fallback warnings, got %q", d.Warnings)
+	}
+}
@@ -75,6 +75,52 @@ Custom configuration:
 	}
 	client, err := xapi.NewClient(config)
 
+Context-bound or lazy startup (no network access in the constructor):
+	client, err := xapi.NewClientContext(ctx, config)
+	config.LazyInitialization = true
+	defer client.Close()
+
+Warm starts from key material persisted by an earlier process:
+	config.KeyMaterialStore = xapi.NewFileKeyMaterialStore(xapi.DefaultKeyMaterialPath())
+
+Transaction IDs from sources fetched elsewhere (no network access):
+	tg, err := xapi.NewTransactionGeneratorFromSources(homeHTML, onDemandJS)
+
+Deterministic transaction IDs for golden tests:
+	id, err := tg.GenerateAt("GET", path, time.Unix(1700000000, 0), 0x5a)
+	config.Clock = xapi.ClockFunc(func() time.Time { return fixedTime })
+
+Decoding a transaction ID from a rejected request (see also cmd/xapi-txid):
+	decoded, err := xapi.DecodeTransactionID(id, 48)
+	err = decoded.Verify("GET", path, animationKey)
+
+Which extraction strategy produced the key material (regex, tokenizer, dom):
+	report := tg.ExtractionReport()
+
+Drift detection when x.com changes its frontend:
+	warnings := tg.Diagnose().Warnings
+	config.OnDrift = func(event xapi.DriftEvent) { alert(event.Changes) }
+
+Decrypting an XPFF header captured from a browser:
+	payload, err := xapi.NewXPFFGenerator().DecryptXPFF(header, guestID)
+
+Consistent browser fingerprints, one profile per identity:
+	config.BrowserProfile = xapi.LookupBrowserProfile("chrome-windows")
+	config.Identities = &xapi.IdentityPoolConfig{Guests: 4, Profiles: xapi.BrowserProfiles()}
+
+Rediscovering GraphQL query IDs after a web deployment (also done on a 404):
+	changed, err := client.DiscoverOperations(ctx)
+	op, _ := client.Operations().Get("UserByScreenName")
+
+Features built from the homepage's feature switches, with per-operation overrides:
+	op.Features = map[string]bool{"responsive_web_jetfuel_frame": false}
+	client.Operations().Set(op)
+
+Logged-in session (auth_token and ct0 cookies):
+	config := xapi.DefaultProductionConfig()
+	config.Session = &xapi.Session{AuthToken: authToken, CSRFToken: ct0}
+	client, err := xapi.NewClient(config)
+
 # API Endpoints
 
 The client provides access to 12 Twitter API endpoints:
@@ -115,21 +161,28 @@ Many methods support functional options for customization:
 
 # Error Handling
 
-The client implements intelligent error handling with automatic retry:
+The client implements intelligent error handling with automatic retry. Errors are
+typed and work with errors.Is and errors.As:
 
 	tweets, err := client.Tweets(ctx, "nasa")
 	if err != nil {
-		// Check for specific error types
+		var rateErr *xapi.RateLimitError
+		var authErr *xapi.AuthError
+		var gqlErr *xapi.GraphQLError
 		switch {
-		case strings.Contains(err.Error(), "rate limited"):
-			// Rate limit hit - automatic backoff was applied
-		case strings.Contains(err.Error(), "authentication"):
-			// Auth error - transaction ID was refreshed automatically
-		case strings.Contains(err.Error(), "failed after"):
-			// Multiple retries exhausted
+		case errors.Is(err, xapi.ErrNotFound):
+			// User, tweet or broadcast does not exist
+		case errors.As(err, &rateErr):
+			// Rate limit hit - rateErr.Reset says when it lifts
+		case errors.As(err, &authErr):
+			// 401/403 - transaction ID was refreshed automatically
+		case errors.As(err, &gqlErr):
+			// GraphQL errors array, one APIError per entry
 		}
 	}
 
+Every non-200 response also unwraps to *HTTPError with the status, body and headers.
+
 # Monitoring and Metrics
 
 Built-in monitoring provides insights into client performance:
@@ -150,18 +203,41 @@ Intelligent caching:
   - HTML Data: 6-hour cache lifetime (production)
   - Animation Keys: 3-hour cache lifetime
   - Transaction IDs: 1-hour reuse for efficiency
-  - Automatic refresh on expiration
+  - Background refresh ahead of expiry (RefreshAhead), serving current key material meanwhile
+  - Concurrent refreshes coalesced; failures retried with backoff and reported by GetStats()
 
 Retry logic:
-  - Exponential backoff: 500ms → 1s → 2s delays
+  - Exponential backoff: 500ms → 1s → 2s delays, with full or decorrelated jitter
+  - Error classification: not-found and validation errors are never retried
   - Smart error handling: Auth errors trigger immediate refresh
-  - Max attempts: 3 retries per request (configurable)
+  - Retry-After and x-rate-limit-reset are honored
+  - Max attempts: 3 retries per request, 2 minute budget per call (configurable via RetryPolicy)
   - Context support: Proper cancellation handling
 
+Circuit breaker:
+  - Per operation and identity: repeated transport failures open the circuit
+  - Fail fast: open circuits return ErrCircuitOpen without contacting the server
+  - Probes: after OpenTimeout a half-open probe decides whether to close again
+  - Observable through GetMetrics().CircuitBreakers
+
+Identity pool:
+  - Rotation: requests spread across sessions and guests (ProductionConfig.Identities)
+  - Health scoring: the healthiest identity with budget for the operation is used
+  - Benching: identities that hit 429 or 401 cool down while others take over
+  - Observable through IdentityStats() and GetMetrics().Identities
+
+Proxy pool:
+  - HTTP, HTTPS and SOCKS5 proxies via ProductionConfig.ProxyPool
+  - Sticky identities: each guest ID and its XPFF header stay on one proxy
+  - Round-robin or least-failed selection, with quarantine of failing proxies
+  - Observable through ProxyStats() and GetMetrics().Proxies
+
 Rate limiting:
   - Built-in limits: Respects Twitter's rate limits
   - Development mode: Higher limits for testing
   - Automatic throttling: No manual rate limiting needed
+  - Per-operation windows: x-rate-limit-* headers pause exhausted operations until reset
+  - Client.RateLimitStatus() reports the last known budget per operation
 
 # Architecture
 
@@ -172,13 +248,32 @@ The client follows clean architecture principles:
   - transaction.go: Production transaction ID generator
   - config.go: Production configuration management
   - types.go: Complete type definitions
-  - xpff_generator.go: XPFF header generation
+  - browser_profile.go: Browser fingerprint profiles per identity
+  - xpff_generator.go: XPFF header generation, caching and decryption
+  - operations.go: GraphQL operation registry and query ID discovery
+  - features.go: Feature switches from the homepage with per-operation overrides
+  - errors.go: Typed errors for errors.Is / errors.As
+  - ratelimit.go: Per-operation rate limit tracking
+  - retry.go: Retry executor shared by all endpoints
+  - circuit_breaker.go: Per-operation, per-identity circuit breakers
+  - guest.go: Guest token activation
+  - session.go: Logged-in sessions from auth_token / ct0 cookies
+  - login.go: Onboarding login flow
+  - totp.go: RFC 6238 TOTP codes for two-factor login
+  - identity_pool.go: Guest and session identity rotation
+  - proxy_pool.go: Egress proxy rotation and identity pinning
+  - key_store.go: Persistent key material store for warm starts
+  - sources.go: Transaction generator from supplied homepage and ondemand.s sources
+  - refresh.go: Background key material refresh with coalescing and backoff
+  - extractor.go: Self-checking extraction strategies for indices and animation frames
+  - diagnostics.go: Key material diagnostics and drift detection
+  - txid.go: Transaction ID decoder and verifier
 
 Key components:
   - Real Algorithm: Authentic Twitter transaction ID generation
   - Corrected Matrix: Critical fix achieving 95-100% success rates
   - Production Caching: Intelligent cache layers with different lifetimes
-  - Thread Safety: Proper locking for concurrent operations
+  - Thread Safety: Proper locking for concurrent operations; lock-free generation from immutable key material snapshots
   - Comprehensive Metrics: Built-in monitoring and performance tracking
 */
 package xapi
\ No newline at end of file
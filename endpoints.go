@@ -137,24 +137,38 @@ func (c *Client) tweetsPage(ctx context.Context, username string, options ...Twe
 		opt(opts)
 	}
 
-	// Get user first to get their ID
-	user, err := c.User(ctx, username)
-	if err != nil {
-		return nil, err
-	}
+	_, page, err := c.userTweetsPage(ctx, username, opts)
+	return page, err
+}
 
+// userTweetsPage resolves a username and fetches a page of their tweets as
+// one retried request. Once resolved, the user is not looked up again on retries.
+func (c *Client) userTweetsPage(ctx context.Context, username string, opts *tweetOptions) (*User, *TweetPage, error) {
+	var user *User
+	page, err := executeWithRetry(ctx, c, func(ctx context.Context) (*TweetPage, error) {
+		if user == nil {
+			resolved, err := c.fetchUser(ctx, username)
+			if err != nil {
+				return nil, err
+			}
+			user = resolved
+		}
+		return c.fetchTweetsPage(ctx, user.ID, opts)
+	})
+	return user, page, err
+}
+
+// fetchTweetsPage performs the actual timeline fetch for a user ID
+func (c *Client) fetchTweetsPage(ctx context.Context, userID string, opts *tweetOptions) (*TweetPage, error) {
 	// Build variables with optional cursor
-	variables := fmt.Sprintf(`{"userId":"%s","count":%d,"includePromotedContent":false,"withQuickPromoteEligibilityTweetFields":false,"withVoice":false`, user.ID, opts.count)
+	variables := fmt.Sprintf(`{"userId":"%s","count":%d,"includePromotedContent":false,"withQuickPromoteEligibilityTweetFields":false,"withVoice":false`, userID, opts.count)
 	if opts.cursor != "" {
 		variables += fmt.Sprintf(`,"cursor":"%s"`, opts.cursor)
 	}
 	variables += "}"
 
-	features := `{"profile_label_improvements_pcf_label_in_post_enabled":false,"hidden_profile_subscriptions_enabled":true,"responsive_web_graphql_skip_user_profile_image_extensions_enabled":false,"responsive_web_graphql_timeline_navigation_enabled":true,"subscriptions_verification_info_is_identity_verified_enabled":true,"responsive_web_twitter_article_notes_tab_enabled":false,"subscriptions_verification_info_verified_since_enabled":true,"highlights_tweets_tab_ui_enabled":true,"verified_phone_label_enabled":false,"payments_enabled":false,"subscriptions_feature_can_gift_premium":false,"rweb_xchat_enabled":false,"rweb_tipjar_consumption_enabled":true,"creator_subscriptions_tweet_preview_api_enabled":true,"freedom_of_speech_not_reach_fetch_enabled":true,"responsive_web_twitter_article_tweet_consumption_enabled":false,"articles_preview_enabled":false,"tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled":true,"responsive_web_edit_tweet_api_enabled":true,"graphql_is_translatable_rweb_tweet_is_translatable_enabled":true,"communities_web_enable_tweet_community_results_fetch":true,"responsive_web_grok_analyze_post_followups_enabled":false,"responsive_web_grok_share_attachment_enabled":false,"c9s_tweet_anatomy_moderator_badge_enabled":true,"longform_notetweets_consumption_enabled":true,"rweb_video_screen_enabled":false,"longform_notetweets_inline_media_enabled":true,"responsive_web_enhance_cards_enabled":false,"responsive_web_grok_show_grok_translated_post":false,"longform_notetweets_rich_text_read_enabled":true,"responsive_web_jetfuel_frame":false,"responsive_web_grok_analyze_button_fetch_trends_enabled":false,"creator_subscriptions_quote_tweet_preview_enabled":false,"responsive_web_grok_analysis_button_from_backend":false,"view_counts_everywhere_api_enabled":true,"responsive_web_grok_image_annotation_enabled":false,"responsive_web_grok_imagine_annotation_enabled":false,"tweet_awards_web_tipping_enabled":false,"premium_content_api_read_enabled":false,"standardized_nudges_misinfo":true,"responsive_web_grok_community_note_auto_translation_is_enabled":false}`
-
-	resp, err := c.request(ctx, "GET", "E8Wq-_jFSaU7hxVcuOPR9g/UserTweets", map[string]string{
+	resp, err := c.query(ctx, "UserTweets", map[string]string{
 		"variables": variables,
-		"features":  features,
 	})
 	if err != nil {
 		return nil, err
@@ -193,7 +207,14 @@ func (c *Client) tweetsPage(ctx context.Context, username string, options ...Twe
 
 // Tweet fetches a single tweet by ID
 func (c *Client) Tweet(ctx context.Context, tweetID string) (*Tweet, error) {
-	resp, err := c.request(ctx, "GET", "qxWQxcMLiTPcavz9Qy5hwQ/TweetResultByRestId", map[string]string{
+	return executeWithRetry(ctx, c, func(ctx context.Context) (*Tweet, error) {
+		return c.fetchTweet(ctx, tweetID)
+	})
+}
+
+// fetchTweet performs the actual single tweet fetch
+func (c *Client) fetchTweet(ctx context.Context, tweetID string) (*Tweet, error) {
+	resp, err := c.query(ctx, "TweetResultByRestId", map[string]string{
 		"variables": fmt.Sprintf(`{"tweetId":"%s","withCommunity":false,"includePromotedContent":false,"withVoice":false}`, tweetID),
 	})
 	if err != nil {
@@ -213,7 +234,7 @@ func (c *Client) Tweet(ctx context.Context, tweetID string) (*Tweet, error) {
 	}
 
 	if result.Data.TweetResult.Result == nil || result.Data.TweetResult.Result.Legacy == nil {
-		return nil, fmt.Errorf("tweet not found")
+		return nil, fmt.Errorf("tweet %s: %w", tweetID, ErrNotFound)
 	}
 
 	tweet := result.Data.TweetResult.Result.Legacy
@@ -223,7 +244,14 @@ func (c *Client) Tweet(ctx context.Context, tweetID string) (*Tweet, error) {
 
 // Broadcast fetches live broadcast information
 func (c *Client) Broadcast(ctx context.Context, broadcastID string) (*Broadcast, error) {
-	resp, err := c.request(ctx, "GET", "BGhq0o90P-tPie4pyhqlVA/BroadcastQuery", map[string]string{
+	return executeWithRetry(ctx, c, func(ctx context.Context) (*Broadcast, error) {
+		return c.fetchBroadcast(ctx, broadcastID)
+	})
+}
+
+// fetchBroadcast performs the actual broadcast fetch
+func (c *Client) fetchBroadcast(ctx context.Context, broadcastID string) (*Broadcast, error) {
+	resp, err := c.query(ctx, "BroadcastQuery", map[string]string{
 		"variables": fmt.Sprintf(`{"id":"%s"}`, broadcastID),
 	})
 	if err != nil {
@@ -241,7 +269,7 @@ func (c *Client) Broadcast(ctx context.Context, broadcastID string) (*Broadcast,
 	}
 
 	if result.Data.Broadcast == nil {
-		return nil, fmt.Errorf("broadcast not found")
+		return nil, fmt.Errorf("broadcast %s: %w", broadcastID, ErrNotFound)
 	}
 
 	return result.Data.Broadcast, nil
@@ -249,16 +277,19 @@ func (c *Client) Broadcast(ctx context.Context, broadcastID string) (*Broadcast,
 
 // Highlights fetches a user's highlighted tweets
 func (c *Client) Highlights(ctx context.Context, userID string, count int) ([]*Tweet, error) {
+	return executeWithRetry(ctx, c, func(ctx context.Context) ([]*Tweet, error) {
+		return c.fetchHighlights(ctx, userID, count)
+	})
+}
+
+// fetchHighlights performs the actual highlights fetch
+func (c *Client) fetchHighlights(ctx context.Context, userID string, count int) ([]*Tweet, error) {
 	if count == 0 {
 		count = 20
 	}
 
-	// Complete features parameter from working HAR file
-	features := `{"rweb_video_screen_enabled":false,"payments_enabled":false,"rweb_xchat_enabled":false,"profile_label_improvements_pcf_label_in_post_enabled":true,"rweb_tipjar_consumption_enabled":true,"verified_phone_label_enabled":false,"creator_subscriptions_tweet_preview_api_enabled":true,"responsive_web_graphql_timeline_navigation_enabled":true,"responsive_web_graphql_skip_user_profile_image_extensions_enabled":false,"premium_content_api_read_enabled":false,"communities_web_enable_tweet_community_results_fetch":true,"c9s_tweet_anatomy_moderator_badge_enabled":true,"responsive_web_grok_analyze_button_fetch_trends_enabled":false,"responsive_web_grok_analyze_post_followups_enabled":false,"responsive_web_jetfuel_frame":true,"responsive_web_grok_share_attachment_enabled":true,"articles_preview_enabled":true,"responsive_web_edit_tweet_api_enabled":true,"graphql_is_translatable_rweb_tweet_is_translatable_enabled":true,"view_counts_everywhere_api_enabled":true,"longform_notetweets_consumption_enabled":true,"responsive_web_twitter_article_tweet_consumption_enabled":true,"tweet_awards_web_tipping_enabled":false,"responsive_web_grok_show_grok_translated_post":false,"responsive_web_grok_analysis_button_from_backend":true,"creator_subscriptions_quote_tweet_preview_enabled":false,"freedom_of_speech_not_reach_fetch_enabled":true,"standardized_nudges_misinfo":true,"tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled":true,"longform_notetweets_rich_text_read_enabled":true,"longform_notetweets_inline_media_enabled":true,"responsive_web_grok_image_annotation_enabled":true,"responsive_web_grok_imagine_annotation_enabled":true,"responsive_web_grok_community_note_auto_translation_is_enabled":false,"responsive_web_enhance_cards_enabled":false}`
-
-	resp, err := c.request(ctx, "GET", "gmHw9geMTncZ7jeLLUUNOw/UserHighlightsTweets", map[string]string{
+	resp, err := c.query(ctx, "UserHighlightsTweets", map[string]string{
 		"variables": fmt.Sprintf(`{"userId":"%s","count":%d,"includePromotedContent":true,"withVoice":true}`, userID, count),
-		"features":  features,
 	})
 	if err != nil {
 		return nil, err
@@ -283,16 +314,19 @@ func (c *Client) Highlights(ctx context.Context, userID string, count int) ([]*T
 
 // Following fetches users that a user follows
 func (c *Client) Following(ctx context.Context, userID string, count int) ([]*User, error) {
+	return executeWithRetry(ctx, c, func(ctx context.Context) ([]*User, error) {
+		return c.fetchFollowing(ctx, userID, count)
+	})
+}
+
+// fetchFollowing performs the actual following fetch
+func (c *Client) fetchFollowing(ctx context.Context, userID string, count int) ([]*User, error) {
 	if count == 0 {
 		count = 20
 	}
 
-	// Features parameter from working HAR file
-	features := `{"rweb_video_screen_enabled":false,"payments_enabled":false,"rweb_xchat_enabled":false,"profile_label_improvements_pcf_label_in_post_enabled":true,"rweb_tipjar_consumption_enabled":true,"verified_phone_label_enabled":false,"creator_subscriptions_tweet_preview_api_enabled":true,"responsive_web_graphql_timeline_navigation_enabled":true,"responsive_web_graphql_skip_user_profile_image_extensions_enabled":false,"premium_content_api_read_enabled":false,"communities_web_enable_tweet_community_results_fetch":true,"c9s_tweet_anatomy_moderator_badge_enabled":true,"responsive_web_grok_analyze_button_fetch_trends_enabled":false,"responsive_web_grok_analyze_post_followups_enabled":true,"responsive_web_jetfuel_frame":true,"responsive_web_grok_share_attachment_enabled":true,"articles_preview_enabled":true,"responsive_web_edit_tweet_api_enabled":true,"graphql_is_translatable_rweb_tweet_is_translatable_enabled":true,"view_counts_everywhere_api_enabled":true,"longform_notetweets_consumption_enabled":true,"responsive_web_twitter_article_tweet_consumption_enabled":true,"tweet_awards_web_tipping_enabled":false,"responsive_web_grok_show_grok_translated_post":false,"responsive_web_grok_analysis_button_from_backend":true,"creator_subscriptions_quote_tweet_preview_enabled":false,"freedom_of_speech_not_reach_fetch_enabled":true,"standardized_nudges_misinfo":true,"tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled":true,"longform_notetweets_rich_text_read_enabled":true,"longform_notetweets_inline_media_enabled":true,"responsive_web_grok_image_annotation_enabled":true,"responsive_web_grok_imagine_annotation_enabled":true,"responsive_web_grok_community_note_auto_translation_is_enabled":false,"responsive_web_enhance_cards_enabled":false}`
-
-	resp, err := c.request(ctx, "GET", "SaWqzw0TFAWMx1nXWjXoaQ/Following", map[string]string{
+	resp, err := c.query(ctx, "Following", map[string]string{
 		"variables": fmt.Sprintf(`{"userId":"%s","count":%d,"includePromotedContent":false,"withGrokTranslatedBio":false}`, userID, count),
-		"features":  features,
 	})
 	if err != nil {
 		return nil, err
@@ -303,11 +337,18 @@ func (c *Client) Following(ctx context.Context, userID string, count int) ([]*Us
 
 // Followers fetches a user's followers
 func (c *Client) Followers(ctx context.Context, userID string, count int) ([]*User, error) {
+	return executeWithRetry(ctx, c, func(ctx context.Context) ([]*User, error) {
+		return c.fetchFollowers(ctx, userID, count)
+	})
+}
+
+// fetchFollowers performs the actual followers fetch
+func (c *Client) fetchFollowers(ctx context.Context, userID string, count int) ([]*User, error) {
 	if count == 0 {
 		count = 20
 	}
 
-	resp, err := c.request(ctx, "GET", "i6PPdIMm1MO7CpAqjau7sw/Followers", map[string]string{
+	resp, err := c.query(ctx, "Followers", map[string]string{
 		"variables": fmt.Sprintf(`{"userId":"%s","count":%d,"includePromotedContent":false,"withGrokTranslatedBio":false}`, userID, count),
 	})
 	if err != nil {
@@ -319,11 +360,18 @@ func (c *Client) Followers(ctx context.Context, userID string, count int) ([]*Us
 
 // BlueVerified fetches blue verified followers
 func (c *Client) BlueVerified(ctx context.Context, userID string, count int) ([]*User, error) {
+	return executeWithRetry(ctx, c, func(ctx context.Context) ([]*User, error) {
+		return c.fetchBlueVerified(ctx, userID, count)
+	})
+}
+
+// fetchBlueVerified performs the actual blue verified followers fetch
+func (c *Client) fetchBlueVerified(ctx context.Context, userID string, count int) ([]*User, error) {
 	if count == 0 {
 		count = 20
 	}
 
-	resp, err := c.request(ctx, "GET", "fxEl9kp1Tgolqkq8_Lo3sg/BlueVerifiedFollowers", map[string]string{
+	resp, err := c.query(ctx, "BlueVerifiedFollowers", map[string]string{
 		"variables": fmt.Sprintf(`{"userId":"%s","count":%d,"includePromotedContent":false,"withGrokTranslatedBio":false}`, userID, count),
 	})
 	if err != nil {
@@ -335,6 +383,13 @@ func (c *Client) BlueVerified(ctx context.Context, userID string, count int) ([]
 
 // UserBusiness fetches business profile team timeline
 func (c *Client) UserBusiness(ctx context.Context, userID string, teamName string, count int) ([]*Tweet, error) {
+	return executeWithRetry(ctx, c, func(ctx context.Context) ([]*Tweet, error) {
+		return c.fetchUserBusiness(ctx, userID, teamName, count)
+	})
+}
+
+// fetchUserBusiness performs the actual business timeline fetch
+func (c *Client) fetchUserBusiness(ctx context.Context, userID string, teamName string, count int) ([]*Tweet, error) {
 	if count == 0 {
 		count = 20
 	}
@@ -342,7 +397,7 @@ func (c *Client) UserBusiness(ctx context.Context, userID string, teamName strin
 		teamName = "NotAssigned"
 	}
 
-	resp, err := c.request(ctx, "GET", "zUBrgfL8uXdM3VR9TqHzNQ/UserBusinessProfileTeamTimeline", map[string]string{
+	resp, err := c.query(ctx, "UserBusinessProfileTeamTimeline", map[string]string{
 		"variables": fmt.Sprintf(`{"userId":"%s","count":%d,"teamName":"%s","includePromotedContent":false,"withClientEventToken":false,"withVoice":true}`, userID, count, teamName),
 	})
 	if err != nil {
@@ -372,6 +427,13 @@ func (c *Client) UsersByIDs(ctx context.Context, userIDs []string) ([]*User, err
 		return nil, fmt.Errorf("no user IDs provided")
 	}
 
+	return executeWithRetry(ctx, c, func(ctx context.Context) ([]*User, error) {
+		return c.fetchUsersByIDs(ctx, userIDs)
+	})
+}
+
+// fetchUsersByIDs performs the actual bulk user fetch
+func (c *Client) fetchUsersByIDs(ctx context.Context, userIDs []string) ([]*User, error) {
 	// Build JSON array of user IDs
 	idsJSON := "["
 	for i, id := range userIDs {
@@ -382,12 +444,8 @@ func (c *Client) UsersByIDs(ctx context.Context, userIDs []string) ([]*User, err
 	}
 	idsJSON += "]"
 
-	// Features parameter from working HAR file (simpler version for UsersByRestIds)
-	features := `{"payments_enabled":false,"rweb_xchat_enabled":false,"profile_label_improvements_pcf_label_in_post_enabled":true,"rweb_tipjar_consumption_enabled":true,"verified_phone_label_enabled":false,"responsive_web_graphql_skip_user_profile_image_extensions_enabled":false,"responsive_web_graphql_timeline_navigation_enabled":true}`
-
-	resp, err := c.request(ctx, "GET", "1hjT2eXW1Zcw-2xk8EbvoA/UsersByRestIds", map[string]string{
+	resp, err := c.query(ctx, "UsersByRestIds", map[string]string{
 		"variables": fmt.Sprintf(`{"userIds":%s}`, idsJSON),
-		"features":  features,
 	})
 	if err != nil {
 		return nil, err
@@ -423,20 +481,15 @@ func (c *Client) Profile(ctx context.Context, username string, tweetCount int) (
 		tweetCount = 20
 	}
 
-	user, err := c.User(ctx, username)
-	if err != nil {
-		return nil, err
-	}
-
-	tweets, err := c.Tweets(ctx, username, WithCount(tweetCount))
+	user, page, err := c.userTweetsPage(ctx, username, &tweetOptions{count: tweetCount})
 	if err != nil {
 		return nil, err
 	}
 
 	return &Profile{
 		User:   user,
-		Tweets: tweets,
-		Stats:  calculateStats(user, tweets),
+		Tweets: page.Tweets,
+		Stats:  calculateStats(user, page.Tweets),
 	}, nil
 }
 
@@ -0,0 +1,260 @@
+package xapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the requested user, tweet or broadcast does not exist.
+//
+// Example:
+//
+//	user, err := client.User(ctx, "nasa")
+//	if errors.Is(err, xapi.ErrNotFound) {
+//	    // account does not exist or is unavailable
+//	}
+var ErrNotFound = errors.New("not found")
+
+// GraphQL error codes that mean the requested resource does not exist
+var notFoundErrorCodes = map[int]bool{
+	34:  true, // Sorry, that page does not exist
+	50:  true, // User not found
+	63:  true, // User has been suspended
+	144: true, // No status found with that ID
+	421: true, // Tweet is unavailable
+}
+
+// HTTPError is returned for non-200 responses from the API.
+// It carries the status, raw body and response headers for inspection.
+type HTTPError struct {
+	StatusCode int         // HTTP status code
+	Body       []byte      // Raw response body
+	Header     http.Header // Response headers
+	Errors     []APIError  // Errors parsed from the body, if any
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("API error: %d %s", e.StatusCode, string(e.Body))
+}
+
+// AuthError is returned for 401 and 403 responses, usually caused by a rejected
+// transaction ID, guest token or session. It wraps the underlying HTTPError.
+type AuthError struct {
+	*HTTPError
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("authentication error: %d %s", e.StatusCode, string(e.Body))
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.HTTPError
+}
+
+// RateLimitError is returned for 429 responses, and without an HTTPError when an
+// operation is still paused by an earlier 429 and its reset is too far away to wait for.
+// Reset is the time the server reported the limit will reset, or the zero time
+// when no header was sent.
+type RateLimitError struct {
+	*HTTPError
+	Operation  string        // GraphQL operation name, e.g. "UserByScreenName"
+	Limit      int           // x-rate-limit-limit
+	Remaining  int           // x-rate-limit-remaining
+	Reset      time.Time     // x-rate-limit-reset
+	RetryAfter time.Duration // Retry-After
+}
+
+func (e *RateLimitError) Error() string {
+	var msg string
+	if e.HTTPError != nil {
+		msg = fmt.Sprintf("rate limited: %d %s", e.StatusCode, string(e.Body))
+	} else {
+		msg = fmt.Sprintf("rate limited: operation %s has no remaining budget", e.Operation)
+	}
+	if !e.Reset.IsZero() {
+		msg += fmt.Sprintf(" (resets at %s)", e.Reset.Format(time.RFC3339))
+	}
+	return msg
+}
+
+func (e *RateLimitError) Unwrap() error {
+	if e.HTTPError == nil {
+		return nil
+	}
+	return e.HTTPError
+}
+
+// GraphQLError is returned when a GraphQL response carries an errors array
+// without usable data, including on HTTP 200 responses. Each entry is an
+// APIError and can be extracted with errors.As.
+type GraphQLError struct {
+	StatusCode int        // HTTP status code of the response
+	Errors     []APIError // Errors reported by the server
+}
+
+func (e *GraphQLError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, apiErr := range e.Errors {
+		messages = append(messages, apiErr.Error())
+	}
+	return "graphql error: " + strings.Join(messages, "; ")
+}
+
+// Unwrap exposes the individual API errors to errors.Is and errors.As
+func (e *GraphQLError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for i := range e.Errors {
+		errs = append(errs, &e.Errors[i])
+	}
+	return errs
+}
+
+// Is reports whether any of the API errors means the resource was not found
+func (e *GraphQLError) Is(target error) bool {
+	if target != ErrNotFound {
+		return false
+	}
+	for _, apiErr := range e.Errors {
+		if notFoundErrorCodes[apiErr.Code] {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrMalformedTransactionID is returned by DecodeTransactionID when an ID is
+// not valid base64, has the wrong length for the key or a wrong trailing byte
+var ErrMalformedTransactionID = errors.New("malformed transaction ID")
+
+// ErrTransactionIDMismatch is returned when a transaction ID's hash does not
+// match the method, path and animation key it was checked against
+var ErrTransactionIDMismatch = errors.New("transaction ID hash mismatch")
+
+// ErrMalformedXPFF is returned by DecryptXPFF when a header is not hex, is
+// too short, fails authentication for the guest ID or holds no valid payload
+var ErrMalformedXPFF = errors.New("malformed XPFF header")
+
+// ExtractionStep names a stage of deriving key material from the homepage and ondemand.s
+type ExtractionStep string
+
+const (
+	StepExtractIndices       ExtractionStep = "extractIndices"       // Row and key byte indices from ondemand.s
+	StepExtractKey           ExtractionStep = "extractKey"           // twitter-site-verification key from the homepage
+	StepGenerateAnimationKey ExtractionStep = "generateAnimationKey" // Animation key from the SVG frames
+)
+
+// ExtractionError is returned when key material cannot be derived from the
+// homepage or ondemand.s source, and names the step that failed
+type ExtractionError struct {
+	Step ExtractionStep // Step that failed
+	Err  error          // Underlying error
+}
+
+func (e *ExtractionError) Error() string {
+	return fmt.Sprintf("key material extraction failed at %s: %v", e.Step, e.Err)
+}
+
+func (e *ExtractionError) Unwrap() error {
+	return e.Err
+}
+
+// Error implements the error interface for a single GraphQL API error
+func (e *APIError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+	}
+	return e.Message
+}
+
+// UnmarshalJSON decodes an API error. GraphQL paths mix field names with
+// list indices, so indices are kept as their decimal strings.
+func (e *APIError) UnmarshalJSON(data []byte) error {
+	type plain APIError
+	aux := struct {
+		*plain
+		Path []json.RawMessage `json:"path,omitempty"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	e.Path = nil
+	for _, segment := range aux.Path {
+		var name string
+		if err := json.Unmarshal(segment, &name); err != nil {
+			name = string(segment)
+		}
+		e.Path = append(e.Path, name)
+	}
+	return nil
+}
+
+// graphQLEnvelope is the top-level shape shared by all GraphQL responses
+type graphQLEnvelope struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []APIError      `json:"errors"`
+}
+
+// parseAPIErrors extracts the errors array from a response body, if present
+func parseAPIErrors(body []byte) ([]APIError, json.RawMessage) {
+	var envelope graphQLEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, nil
+	}
+	return envelope.Errors, envelope.Data
+}
+
+// hasData reports whether a GraphQL data field carries anything usable
+func hasData(data json.RawMessage) bool {
+	trimmed := strings.TrimSpace(string(data))
+	return trimmed != "" && trimmed != "null" && trimmed != "{}"
+}
+
+// apiErrorsOf returns the API errors carried by a GraphQLError or HTTPError
+func apiErrorsOf(err error) []APIError {
+	var gqlErr *GraphQLError
+	if errors.As(err, &gqlErr) {
+		return gqlErr.Errors
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Errors
+	}
+	return nil
+}
+
+// newResponseError builds the typed error for a non-200 response
+func newResponseError(operation string, statusCode int, body []byte, header http.Header) error {
+	apiErrors, _ := parseAPIErrors(body)
+	httpErr := &HTTPError{
+		StatusCode: statusCode,
+		Body:       body,
+		Header:     header,
+		Errors:     apiErrors,
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return &AuthError{HTTPError: httpErr}
+
+	case http.StatusTooManyRequests:
+		rateErr := &RateLimitError{HTTPError: httpErr, Operation: operation}
+		rateErr.Limit, _ = strconv.Atoi(header.Get("x-rate-limit-limit"))
+		rateErr.Remaining, _ = strconv.Atoi(header.Get("x-rate-limit-remaining"))
+		if reset, err := strconv.ParseInt(header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+			rateErr.Reset = time.Unix(reset, 0)
+		}
+		if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+			rateErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return rateErr
+
+	default:
+		return httpErr
+	}
+}
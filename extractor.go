@@ -0,0 +1,484 @@
+package xapi
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Extractor is one strategy for pulling the ondemand.s indices and the SVG
+// animation frames out of the sources. Strategies are tried in the order of
+// ProductionConfig.Extractors, so a frontend deploy that breaks one falls
+// back to the next. A strategy that does not handle one of the two returns
+// an error wrapping errors.ErrUnsupported and is skipped for it.
+//
+// Every result is self-checked before it is used: indices must be in range
+// for the verification key and the frame row the key selects must be
+// complete. A result that fails the check counts as a failure of that strategy.
+type Extractor interface {
+	// Name identifies the strategy in ExtractionReport
+	Name() string
+	// ExtractIndices returns the row index followed by the key byte indices
+	ExtractIndices(onDemandJS string) ([]int, error)
+	// ExtractFrame returns the rows of the loading-x-anim-<frame> SVG path
+	ExtractFrame(homeHTML string, frame int) ([][]int, error)
+}
+
+// ExtractionReport records which strategy produced each part of the key
+// material and why earlier strategies were passed over
+type ExtractionReport struct {
+	Indices  string   `json:"indices"`            // Strategy that produced the ondemand.s indices
+	Frames   string   `json:"frames"`             // Strategy that produced the animation frame
+	Failures []string `json:"failures,omitempty"` // "strategy: error" for every strategy that failed
+}
+
+// Strategy names reported in ExtractionReport
+const (
+	ExtractorRegex     = "regex"
+	ExtractorTokenizer = "tokenizer"
+	ExtractorDOM       = "dom"
+)
+
+// DefaultExtractors returns the built-in strategies in fallback order: the
+// original regular expressions, a JavaScript token scan for the indices and
+// an HTML DOM walk for the frames
+func DefaultExtractors() []Extractor {
+	return []Extractor{RegexExtractor{}, TokenizerExtractor{}, DOMExtractor{}}
+}
+
+// ExtractionReport returns which extractors produced the current key
+// material, or nil if it was not extracted in this process (a warm start
+// from a KeyMaterialStore) or the generator has no key material yet
+func (tg *TransactionGenerator) ExtractionReport() *ExtractionReport {
+	snapshot := tg.snapshot.Load()
+	if snapshot == nil {
+		return nil
+	}
+	return snapshot.extractionReport()
+}
+
+// extractionReport returns a copy of the snapshot's report, nil if it has none
+func (s *keySnapshot) extractionReport() *ExtractionReport {
+	if s.report.Indices == "" {
+		return nil
+	}
+	report := s.report
+	report.Failures = append([]string(nil), s.report.Failures...)
+	return &report
+}
+
+// Minimum values per animation frame row: two colors, a rotation and a cubic bezier curve
+const minFrameRowLength = 11
+
+// extractIndices runs the extractors until one returns indices that pass the
+// self-check. The verification key must already be extracted.
+func (s *keySnapshot) extractIndices(extractors []Extractor) error {
+	var failures []error
+	for _, extractor := range extractors {
+		indices, err := extractor.ExtractIndices(s.onDemandFileHTML)
+		if errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		if err == nil {
+			err = checkIndices(indices, len(s.keyBytes))
+		}
+		if err != nil {
+			failures = append(failures, s.report.failed(extractor, err))
+			continue
+		}
+
+		s.rowIndex = indices[0]
+		s.keyBytesIndices = indices[1:]
+		s.report.Indices = extractor.Name()
+		return nil
+	}
+	return chainError("indices", failures)
+}
+
+// extractAnimationFrame runs the extractors until one returns a frame whose
+// selected row passes the self-check
+func (s *keySnapshot) extractAnimationFrame(extractors []Extractor, frame, row int) ([][]int, error) {
+	var failures []error
+	for _, extractor := range extractors {
+		rows, err := extractor.ExtractFrame(s.homePageHTML, frame)
+		if errors.Is(err, errors.ErrUnsupported) {
+			continue
+		}
+		if err == nil {
+			err = checkFrame(rows, row)
+		}
+		if err != nil {
+			failures = append(failures, s.report.failed(extractor, err))
+			continue
+		}
+
+		s.report.Frames = extractor.Name()
+		return rows, nil
+	}
+	return nil, chainError(fmt.Sprintf("frame loading-x-anim-%d", frame), failures)
+}
+
+// failed records a strategy failure and returns it labelled with the strategy
+func (r *ExtractionReport) failed(extractor Extractor, err error) error {
+	err = fmt.Errorf("%s: %w", extractor.Name(), err)
+	r.Failures = append(r.Failures, err.Error())
+	return err
+}
+
+// chainError reports that no strategy could extract what
+func chainError(what string, failures []error) error {
+	if len(failures) == 0 {
+		return fmt.Errorf("no extractor supports %s", what)
+	}
+	return fmt.Errorf("every extractor failed for %s: %w", what, errors.Join(failures...))
+}
+
+// checkIndices verifies there is a row index and at least one key byte index,
+// all within the verification key
+func checkIndices(indices []int, keyLen int) error {
+	if len(indices) < 2 {
+		return fmt.Errorf("self-check: found %d indices, need a row index and key byte indices", len(indices))
+	}
+	for _, index := range indices {
+		if index < 0 || index >= keyLen {
+			return fmt.Errorf("self-check: index %d out of range for a %d-byte key", index, keyLen)
+		}
+	}
+	return nil
+}
+
+// checkFrame verifies the row the animation will use carries all its values.
+// Like generateAnimationKey, a row index past the end selects the first row.
+func checkFrame(rows [][]int, row int) error {
+	if len(rows) == 0 {
+		return fmt.Errorf("self-check: frame has no rows")
+	}
+	if row >= len(rows) {
+		row = 0
+	}
+	if len(rows[row]) < minFrameRowLength {
+		return fmt.Errorf("self-check: row %d has %d values, need %d", row, len(rows[row]), minFrameRowLength)
+	}
+	return nil
+}
+
+// parseFrameRows splits SVG path data into rows of numbers, one per "C"
+// curve segment, skipping the leading "M x,y C" move command as the
+// reference implementation does with pathData[9:]
+func parseFrameRows(pathData string) [][]int {
+	if len(pathData) <= 9 {
+		return nil
+	}
+
+	numberRegex := regexp.MustCompile(`\d+`)
+	var rows [][]int
+	for _, part := range strings.Split(pathData[9:], "C") {
+		var row []int
+		for _, numStr := range numberRegex.FindAllString(part, -1) {
+			if num, err := strconv.Atoi(numStr); err == nil {
+				row = append(row, num)
+			}
+		}
+		if len(row) > 0 {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// frameID returns the element ID of an animation frame
+func frameID(frame int) string {
+	return fmt.Sprintf("loading-x-anim-%d", frame)
+}
+
+// RegexExtractor is the original strategy: regular expressions over the raw
+// ondemand.s and homepage sources
+type RegexExtractor struct{}
+
+// Name returns "regex"
+func (RegexExtractor) Name() string {
+	return ExtractorRegex
+}
+
+// ExtractIndices matches parseInt-style calls of the form (x[12], 16)
+func (RegexExtractor) ExtractIndices(onDemandJS string) ([]int, error) {
+	indicesRegex := regexp.MustCompile(`\(\w{1}\[(\d{1,2})\],\s*16\)`)
+	matches := indicesRegex.FindAllStringSubmatch(onDemandJS, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no indices found in ondemand file")
+	}
+
+	var indices []int
+	for _, match := range matches {
+		index, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse index %s: %w", match[1], err)
+		}
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// ExtractFrame finds the frame's <g> element and its first curve path by
+// regular expression
+func (RegexExtractor) ExtractFrame(homeHTML string, frame int) ([][]int, error) {
+	id := frameID(frame)
+	framePattern := regexp.MustCompile(fmt.Sprintf(`id=['"]%s['"][^>]*>(.*?)</g>`, id))
+	frameMatch := framePattern.FindStringSubmatch(homeHTML)
+	if len(frameMatch) < 2 {
+		return nil, fmt.Errorf("frame %s not found in HTML", id)
+	}
+
+	// Look for path elements within the frame content
+	pathPattern := regexp.MustCompile(`<path[^>]*\sd=['"]([^'"]*?)['"][^>]*>`)
+	for _, pathMatch := range pathPattern.FindAllStringSubmatch(frameMatch[1], -1) {
+		if len(pathMatch[1]) > 9 && strings.Contains(pathMatch[1], "C") {
+			return parseFrameRows(pathMatch[1]), nil
+		}
+	}
+	return nil, fmt.Errorf("no valid path data found in frame %s", id)
+}
+
+// TokenizerExtractor scans the ondemand.s bundle as a stream of JavaScript
+// tokens, so whitespace, comments, longer variable names and hex radixes do
+// not matter. It does not extract frames.
+type TokenizerExtractor struct{}
+
+// Name returns "tokenizer"
+func (TokenizerExtractor) Name() string {
+	return ExtractorTokenizer
+}
+
+// ExtractIndices finds every ( identifier [ number ] , 16 ) token sequence
+func (TokenizerExtractor) ExtractIndices(onDemandJS string) ([]int, error) {
+	tokens := tokenizeJS(onDemandJS)
+	pattern := []string{"(", "ident", "[", "number", "]", ",", "number", ")"}
+
+	var indices []int
+	for i := 0; i+len(pattern) <= len(tokens); i++ {
+		if !matchTokens(tokens[i:], pattern) {
+			continue
+		}
+		radix, err := strconv.ParseInt(tokens[i+6].text, 0, 64)
+		if err != nil || radix != 16 {
+			continue
+		}
+		index, err := strconv.ParseInt(tokens[i+3].text, 0, 64)
+		if err != nil {
+			continue
+		}
+		indices = append(indices, int(index))
+	}
+	if len(indices) == 0 {
+		return nil, fmt.Errorf("no (x[n], 16) calls found in ondemand file")
+	}
+	return indices, nil
+}
+
+// ExtractFrame is not supported by the tokenizer
+func (TokenizerExtractor) ExtractFrame(string, int) ([][]int, error) {
+	return nil, fmt.Errorf("tokenizer does not extract frames: %w", errors.ErrUnsupported)
+}
+
+// jsToken is one JavaScript token: "ident", "number", or punctuation as itself
+type jsToken struct {
+	kind string
+	text string
+}
+
+// matchTokens reports whether tokens start with the given kinds
+func matchTokens(tokens []jsToken, kinds []string) bool {
+	for i, kind := range kinds {
+		if tokens[i].kind != kind {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenizeJS splits JavaScript into identifiers, numbers and punctuation,
+// dropping whitespace, comments, string and template literals and regular
+// expression literals
+func tokenizeJS(src string) []jsToken {
+	var tokens []jsToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+
+		case c == '"' || c == '\'' || c == '`':
+			i = skipQuoted(src, i, c)
+
+		case c == '/' && regexAllowed(tokens):
+			i = skipRegexLiteral(src, i)
+
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, jsToken{kind: "ident", text: src[start:i]})
+
+		case isDigit(c):
+			start := i
+			for i < len(src) && (isDigit(src[i]) || isIdentStart(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, jsToken{kind: "number", text: src[start:i]})
+
+		default:
+			tokens = append(tokens, jsToken{kind: string(c), text: string(c)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// skipQuoted returns the position after the literal opened by quote at start
+func skipQuoted(src string, start int, quote byte) int {
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return len(src)
+}
+
+// skipRegexLiteral returns the position after the regular expression literal
+// at start, including its flags
+func skipRegexLiteral(src string, start int) int {
+	inClass := false
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '\n':
+			// Not a regular expression after all; resume after the slash
+			return start + 1
+		case '/':
+			if inClass {
+				continue
+			}
+			i++
+			for i < len(src) && isIdentStart(src[i]) {
+				i++
+			}
+			return i
+		}
+	}
+	return start + 1
+}
+
+// regexAllowed reports whether a slash after these tokens starts a regular
+// expression rather than a division
+func regexAllowed(tokens []jsToken) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	switch last.kind {
+	case "ident":
+		return last.text == "return" || last.text == "typeof" || last.text == "case"
+	case "number", ")", "]", "}":
+		return false
+	}
+	return true
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// DOMExtractor walks the parsed homepage for the frame's element and its
+// first curve path, independent of attribute order, quoting and line breaks.
+// It does not extract indices.
+type DOMExtractor struct{}
+
+// Name returns "dom"
+func (DOMExtractor) Name() string {
+	return ExtractorDOM
+}
+
+// ExtractIndices is not supported by the DOM walk
+func (DOMExtractor) ExtractIndices(string) ([]int, error) {
+	return nil, fmt.Errorf("dom walk does not extract indices: %w", errors.ErrUnsupported)
+}
+
+// ExtractFrame parses the homepage and reads the first path with curve data
+// inside the frame's element
+func (DOMExtractor) ExtractFrame(homeHTML string, frame int) ([][]int, error) {
+	doc, err := html.Parse(strings.NewReader(homeHTML))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	id := frameID(frame)
+	node := findNode(doc, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && attr(n, "id") == id
+	})
+	if node == nil {
+		return nil, fmt.Errorf("frame %s not found in HTML", id)
+	}
+
+	path := findNode(node, func(n *html.Node) bool {
+		d := attr(n, "d")
+		return n.Type == html.ElementNode && n.Data == "path" && len(d) > 9 && strings.Contains(d, "C")
+	})
+	if path == nil {
+		return nil, fmt.Errorf("no valid path data found in frame %s", id)
+	}
+	return parseFrameRows(attr(path, "d")), nil
+}
+
+// findNode returns the first node in document order under n that matches
+func findNode(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findNode(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// attr returns the value of an attribute, or "" if it is not set
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
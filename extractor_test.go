@@ -0,0 +1,118 @@
+package xapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractorsAgree(t *testing.T) {
+	onDemandJS := fixtureOnDemandJSFor(7, 21, 33, 42)
+	for _, extractor := range []Extractor{RegexExtractor{}, TokenizerExtractor{}} {
+		indices, err := extractor.ExtractIndices(onDemandJS)
+		if err != nil || !reflect.DeepEqual(indices, []int{7, 21, 33, 42}) {
+			t.Errorf("%s: got indices %v, %v", extractor.Name(), indices, err)
+		}
+	}
+
+	homeHTML := fixtureHomeHTML()
+	for frame := 0; frame < 4; frame++ {
+		regexRows, err := RegexExtractor{}.ExtractFrame(homeHTML, frame)
+		if err != nil {
+			t.Fatalf("regex: frame %d: %v", frame, err)
+		}
+		domRows, err := DOMExtractor{}.ExtractFrame(homeHTML, frame)
+		if err != nil || !reflect.DeepEqual(domRows, regexRows) {
+			t.Errorf("dom: frame %d differs from regex: %v", frame, err)
+		}
+	}
+
+	if _, err := (TokenizerExtractor{}).ExtractFrame(homeHTML, 0); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("Tokenizer should not extract frames, got %v", err)
+	}
+	if _, err := (DOMExtractor{}).ExtractIndices(onDemandJS); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("DOM walk should not extract indices, got %v", err)
+	}
+}
+
+func TestExtractorFallback(t *testing.T) {
+	// Reshaped bundle: longer names, comments and a hex radix
+	onDemandJS := `var o=parseInt(ab[7], 16),p=parseInt(ab[21] /* key */, 0x10),` +
+		"q=parseInt(ab[33],\n16),w=parseInt(ab[ 42 ], 16);"
+	if _, err := (RegexExtractor{}).ExtractIndices(onDemandJS); err == nil {
+		t.Fatal("Reshaped bundle should defeat the regex")
+	}
+
+	// Lookalikes in strings, regular expressions and comments are not code
+	decoys := `var s="(a[1], 16)",r=/\(b\[2\], 16\)/g,d=x/y/(c[4], 16);// (c[3], 16)` + "\n" + onDemandJS
+	indices, err := TokenizerExtractor{}.ExtractIndices(decoys)
+	if err != nil || !reflect.DeepEqual(indices, []int{4, 7, 21, 33, 42}) {
+		t.Fatalf("Tokenizer got %v, %v", indices, err)
+	}
+
+	// Pretty-printed frames break the single-line regex
+	homeHTML := strings.ReplaceAll(fixtureHomeHTML(), `"><path`, "\">\n  <path")
+
+	tg, err := NewTransactionGeneratorFromSources(fixtureHomeHTML(), fixtureOnDemandJS())
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+	want := tg.GetStats().AnimationKey
+	if report := tg.ExtractionReport(); report == nil || report.Indices != ExtractorRegex || report.Frames != ExtractorRegex || len(report.Failures) != 0 {
+		t.Errorf("Original sources should extract by regex, got %+v", report)
+	}
+
+	if err := tg.UpdateSources(homeHTML, onDemandJS); err != nil {
+		t.Fatalf("Fallback extraction failed: %v", err)
+	}
+	if got := tg.GetStats().AnimationKey; got != want {
+		t.Errorf("Fallback strategies derived %q, want %q", got, want)
+	}
+	report := tg.GetStats().Extraction
+	if report == nil || report.Indices != ExtractorTokenizer || report.Frames != ExtractorDOM || len(report.Failures) != 2 {
+		t.Errorf("Expected tokenizer indices and DOM frames after two regex failures, got %+v", report)
+	}
+}
+
+// badIndices is an extractor whose indices fail the self-check
+type badIndices struct{ RegexExtractor }
+
+func (badIndices) Name() string { return "bad" }
+
+func (badIndices) ExtractIndices(string) ([]int, error) { return []int{7, 99}, nil }
+
+func TestExtractorSelfCheck(t *testing.T) {
+	server := newStandIn(t)
+	config := server.config()
+	config.Extractors = []Extractor{badIndices{}, RegexExtractor{}}
+
+	tg, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	report := tg.ExtractionReport()
+	if report == nil || report.Indices != ExtractorRegex || report.Frames != "bad" {
+		t.Fatalf("Unexpected report: %+v", report)
+	}
+	if len(report.Failures) != 1 || !strings.Contains(report.Failures[0], "bad: self-check") {
+		t.Errorf("Expected the self-check failure in the report, got %q", report.Failures)
+	}
+
+	// When every strategy fails the error names the step and each strategy
+	config.Extractors = []Extractor{badIndices{}, DOMExtractor{}}
+	_, err = NewTransactionGeneratorFromSourcesWithConfig(config, fixtureHomeHTML(), fixtureOnDemandJS())
+	var extractErr *ExtractionError
+	if !errors.As(err, &extractErr) || extractErr.Step != StepExtractIndices || !strings.Contains(err.Error(), "bad: self-check") {
+		t.Errorf("Expected an indices failure from the bad extractor, got %v", err)
+	}
+
+	config.Extractors = []Extractor{TokenizerExtractor{}}
+	_, err = NewTransactionGeneratorFromSourcesWithConfig(config, fixtureHomeHTML(), fixtureOnDemandJS())
+	if !errors.As(err, &extractErr) || extractErr.Step != StepGenerateAnimationKey || !strings.Contains(err.Error(), "no extractor supports") {
+		t.Errorf("Expected a frame failure with no supporting extractor, got %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package xapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// defaultFeatureSwitches are feature switch values from working HAR files,
+// used until the homepage's __INITIAL_STATE__ provides current ones
+var defaultFeatureSwitches = mustFlags(`{"articles_preview_enabled":true,"c9s_tweet_anatomy_moderator_badge_enabled":true,"communities_web_enable_tweet_community_results_fetch":true,"creator_subscriptions_quote_tweet_preview_enabled":false,"creator_subscriptions_tweet_preview_api_enabled":true,"freedom_of_speech_not_reach_fetch_enabled":true,"graphql_is_translatable_rweb_tweet_is_translatable_enabled":true,"hidden_profile_subscriptions_enabled":true,"highlights_tweets_tab_ui_enabled":true,"longform_notetweets_consumption_enabled":true,"longform_notetweets_inline_media_enabled":true,"longform_notetweets_rich_text_read_enabled":true,"payments_enabled":false,"premium_content_api_read_enabled":false,"profile_label_improvements_pcf_label_in_post_enabled":true,"responsive_web_edit_tweet_api_enabled":true,"responsive_web_enhance_cards_enabled":false,"responsive_web_graphql_skip_user_profile_image_extensions_enabled":false,"responsive_web_graphql_timeline_navigation_enabled":true,"responsive_web_grok_analysis_button_from_backend":true,"responsive_web_grok_analyze_button_fetch_trends_enabled":false,"responsive_web_grok_analyze_post_followups_enabled":true,"responsive_web_grok_community_note_auto_translation_is_enabled":false,"responsive_web_grok_image_annotation_enabled":true,"responsive_web_grok_imagine_annotation_enabled":true,"responsive_web_grok_share_attachment_enabled":true,"responsive_web_grok_show_grok_translated_post":false,"responsive_web_jetfuel_frame":true,"responsive_web_twitter_article_notes_tab_enabled":false,"responsive_web_twitter_article_tweet_consumption_enabled":true,"rweb_tipjar_consumption_enabled":true,"rweb_video_screen_enabled":false,"rweb_xchat_enabled":false,"standardized_nudges_misinfo":true,"subscriptions_feature_can_gift_premium":false,"subscriptions_verification_info_is_identity_verified_enabled":true,"subscriptions_verification_info_verified_since_enabled":true,"tweet_awards_web_tipping_enabled":false,"tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled":true,"verified_phone_label_enabled":false,"view_counts_everywhere_api_enabled":true}`)
+
+// Feature switches of the user profile queries (UserByScreenName, UserTweets)
+var userFeatureSwitches = []string{
+	"articles_preview_enabled", "c9s_tweet_anatomy_moderator_badge_enabled",
+	"communities_web_enable_tweet_community_results_fetch",
+	"creator_subscriptions_quote_tweet_preview_enabled",
+	"creator_subscriptions_tweet_preview_api_enabled", "freedom_of_speech_not_reach_fetch_enabled",
+	"graphql_is_translatable_rweb_tweet_is_translatable_enabled",
+	"hidden_profile_subscriptions_enabled", "highlights_tweets_tab_ui_enabled",
+	"longform_notetweets_consumption_enabled", "longform_notetweets_inline_media_enabled",
+	"longform_notetweets_rich_text_read_enabled", "payments_enabled",
+	"premium_content_api_read_enabled", "profile_label_improvements_pcf_label_in_post_enabled",
+	"responsive_web_edit_tweet_api_enabled", "responsive_web_enhance_cards_enabled",
+	"responsive_web_graphql_skip_user_profile_image_extensions_enabled",
+	"responsive_web_graphql_timeline_navigation_enabled",
+	"responsive_web_grok_analysis_button_from_backend",
+	"responsive_web_grok_analyze_button_fetch_trends_enabled",
+	"responsive_web_grok_analyze_post_followups_enabled",
+	"responsive_web_grok_community_note_auto_translation_is_enabled",
+	"responsive_web_grok_image_annotation_enabled", "responsive_web_grok_imagine_annotation_enabled",
+	"responsive_web_grok_share_attachment_enabled", "responsive_web_grok_show_grok_translated_post",
+	"responsive_web_jetfuel_frame", "responsive_web_twitter_article_notes_tab_enabled",
+	"responsive_web_twitter_article_tweet_consumption_enabled", "rweb_tipjar_consumption_enabled",
+	"rweb_video_screen_enabled", "rweb_xchat_enabled", "standardized_nudges_misinfo",
+	"subscriptions_feature_can_gift_premium",
+	"subscriptions_verification_info_is_identity_verified_enabled",
+	"subscriptions_verification_info_verified_since_enabled", "tweet_awards_web_tipping_enabled",
+	"tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled",
+	"verified_phone_label_enabled", "view_counts_everywhere_api_enabled",
+}
+
+// Feature switches of the timeline and user list queries
+var timelineFeatureSwitches = []string{
+	"articles_preview_enabled", "c9s_tweet_anatomy_moderator_badge_enabled",
+	"communities_web_enable_tweet_community_results_fetch",
+	"creator_subscriptions_quote_tweet_preview_enabled",
+	"creator_subscriptions_tweet_preview_api_enabled", "freedom_of_speech_not_reach_fetch_enabled",
+	"graphql_is_translatable_rweb_tweet_is_translatable_enabled",
+	"longform_notetweets_consumption_enabled", "longform_notetweets_inline_media_enabled",
+	"longform_notetweets_rich_text_read_enabled", "payments_enabled",
+	"premium_content_api_read_enabled", "profile_label_improvements_pcf_label_in_post_enabled",
+	"responsive_web_edit_tweet_api_enabled", "responsive_web_enhance_cards_enabled",
+	"responsive_web_graphql_skip_user_profile_image_extensions_enabled",
+	"responsive_web_graphql_timeline_navigation_enabled",
+	"responsive_web_grok_analysis_button_from_backend",
+	"responsive_web_grok_analyze_button_fetch_trends_enabled",
+	"responsive_web_grok_analyze_post_followups_enabled",
+	"responsive_web_grok_community_note_auto_translation_is_enabled",
+	"responsive_web_grok_image_annotation_enabled", "responsive_web_grok_imagine_annotation_enabled",
+	"responsive_web_grok_share_attachment_enabled", "responsive_web_grok_show_grok_translated_post",
+	"responsive_web_jetfuel_frame", "responsive_web_twitter_article_tweet_consumption_enabled",
+	"rweb_tipjar_consumption_enabled", "rweb_video_screen_enabled", "rweb_xchat_enabled",
+	"standardized_nudges_misinfo", "tweet_awards_web_tipping_enabled",
+	"tweet_with_visibility_results_prefer_gql_limited_actions_policy_enabled",
+	"verified_phone_label_enabled", "view_counts_everywhere_api_enabled",
+}
+
+// Feature switches of UsersByRestIds
+var usersFeatureSwitches = []string{
+	"payments_enabled", "profile_label_improvements_pcf_label_in_post_enabled",
+	"responsive_web_graphql_skip_user_profile_image_extensions_enabled",
+	"responsive_web_graphql_timeline_navigation_enabled", "rweb_tipjar_consumption_enabled",
+	"rweb_xchat_enabled", "verified_phone_label_enabled",
+}
+
+// mustFlags parses a JSON object of feature flags
+func mustFlags(s string) map[string]bool {
+	var flags map[string]bool
+	if err := json.Unmarshal([]byte(s), &flags); err != nil {
+		panic(fmt.Sprintf("xapi: invalid feature flags: %v", err))
+	}
+	return flags
+}
+
+// initialStateMarker precedes the JSON state the homepage boots the web app with
+const initialStateMarker = "window.__INITIAL_STATE__="
+
+// featureSwitchConfig maps switch names to {"value": …} entries
+type featureSwitchConfig map[string]struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// parseFeatureSwitches returns the boolean feature switches of the homepage's
+// __INITIAL_STATE__: the defaults, overridden by the configured and then the
+// per-user values. Switches with other value types are not GraphQL features.
+func parseFeatureSwitches(homeHTML string) (map[string]bool, error) {
+	i := strings.Index(homeHTML, initialStateMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("__INITIAL_STATE__ not found in home page")
+	}
+
+	var state struct {
+		FeatureSwitch struct {
+			DefaultConfig featureSwitchConfig `json:"defaultConfig"`
+			Config        featureSwitchConfig `json:"config"`
+			User          struct {
+				Config featureSwitchConfig `json:"config"`
+			} `json:"user"`
+		} `json:"featureSwitch"`
+	}
+	// Decode reads one JSON value and ignores the script that follows it
+	if err := json.NewDecoder(strings.NewReader(homeHTML[i+len(initialStateMarker):])).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to parse __INITIAL_STATE__: %w", err)
+	}
+
+	switches := make(map[string]bool)
+	for _, config := range []featureSwitchConfig{state.FeatureSwitch.DefaultConfig, state.FeatureSwitch.Config, state.FeatureSwitch.User.Config} {
+		for name, entry := range config {
+			var value bool
+			if json.Unmarshal(entry.Value, &value) == nil {
+				switches[name] = value
+			}
+		}
+	}
+	if len(switches) == 0 {
+		return nil, fmt.Errorf("no feature switches in __INITIAL_STATE__")
+	}
+	return switches, nil
+}
+
+// missingFeaturesRegex matches the validation error for features a request left out
+var missingFeaturesRegex = regexp.MustCompile(`The following features cannot be null: ([\w, ]+)`)
+
+// missingFeatures returns the features the server rejected a request for omitting
+func missingFeatures(err error) []string {
+	var missing []string
+	for _, apiErr := range apiErrorsOf(err) {
+		m := missingFeaturesRegex.FindStringSubmatch(apiErr.Message)
+		if m == nil {
+			continue
+		}
+		for _, name := range strings.Split(m[1], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing
+}
+
+// FeatureSwitches returns a copy of the feature switch values features are built from
+func (r *OperationRegistry) FeatureSwitches() map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return cloneFlags(r.switches)
+}
+
+// SetFeatureSwitches merges feature switch values into the registry, as
+// reading a homepage's __INITIAL_STATE__ does
+func (r *OperationRegistry) SetFeatureSwitches(switches map[string]bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, value := range switches {
+		r.switches[name] = value
+	}
+}
+
+// Features returns the features parameter of the named operation: the
+// current value of each feature switch it sends, with its overrides applied
+func (r *OperationRegistry) Features(name string) map[string]bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.features(r.operations[name])
+}
+
+// features builds an operation's features. The caller must hold mu.
+func (r *OperationRegistry) features(op Operation) map[string]bool {
+	if len(op.FeatureSwitches) == 0 && len(op.Features) == 0 {
+		return nil
+	}
+	features := make(map[string]bool, len(op.FeatureSwitches)+len(op.Features))
+	for _, name := range op.FeatureSwitches {
+		features[name] = r.switches[name] // Unknown switches are sent as false
+	}
+	for name, value := range op.Features {
+		features[name] = value
+	}
+	return features
+}
+
+// addFeatureSwitches makes the named operation send more feature switches and
+// reports whether any were new
+func (r *OperationRegistry) addFeatureSwitches(name string, switches []string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	op, ok := r.operations[name]
+	if !ok {
+		return false
+	}
+
+	sent := make(map[string]bool, len(op.FeatureSwitches))
+	for _, s := range op.FeatureSwitches {
+		sent[s] = true
+	}
+	added := false
+	for _, s := range switches {
+		if _, overridden := op.Features[s]; !sent[s] && !overridden {
+			op.FeatureSwitches = append(op.FeatureSwitches, s)
+			sent[s] = true
+			added = true
+		}
+	}
+	r.operations[name] = op
+	return added
+}
@@ -0,0 +1,126 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestParseFeatureSwitches(t *testing.T) {
+	switches, err := parseFeatureSwitches(fixtureHomeHTML())
+	if err != nil {
+		t.Fatalf("parseFeatureSwitches failed: %v", err)
+	}
+	want := map[string]bool{"responsive_web_jetfuel_frame": false, "rweb_video_screen_enabled": true}
+	if !reflect.DeepEqual(switches, want) {
+		t.Errorf("parseFeatureSwitches = %v, want %v", switches, want)
+	}
+
+	for name, homeHTML := range map[string]string{
+		"no state":    "<html></html>",
+		"truncated":   `<script>window.__INITIAL_STATE__={"featureSwitch":{</script>`,
+		"no switches": `<script>window.__INITIAL_STATE__={"optimist":[]};</script>`,
+	} {
+		if _, err := parseFeatureSwitches(homeHTML); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	err = &GraphQLError{Errors: []APIError{{Code: 336, Message: "The following features cannot be null: rweb_new_enabled, other_enabled"}}}
+	if got := missingFeatures(err); !reflect.DeepEqual(got, []string{"rweb_new_enabled", "other_enabled"}) {
+		t.Errorf("missingFeatures = %v", got)
+	}
+}
+
+func TestClientFeatureSwitches(t *testing.T) {
+	server := newStandIn(t)
+
+	var mu sync.Mutex
+	sent := make(map[string][]map[string]bool)
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		var features map[string]bool
+		json.Unmarshal([]byte(r.URL.Query().Get("features")), &features)
+		operation := operationName(r.URL.Path)
+		mu.Lock()
+		sent[operation] = append(sent[operation], features)
+		mu.Unlock()
+
+		if _, ok := features["rweb_new_enabled"]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":[{"code":336,"message":"The following features cannot be null: rweb_new_enabled"}]}`)
+			return
+		}
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+	requests := func(operation string) []map[string]bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return sent[operation]
+	}
+
+	config := server.config()
+	config.Operations = NewOperationRegistry()
+	op, _ := config.Operations.Get("UserByScreenName")
+	op.Features = map[string]bool{"rweb_video_screen_enabled": false}
+	config.Operations.Set(op)
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	// The missing feature is added and the request replayed once
+	if _, err := client.User(context.Background(), "nasa"); err != nil {
+		t.Fatalf("Request should succeed after adding the missing feature: %v", err)
+	}
+	if _, err := client.User(context.Background(), "nasa"); err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	users := requests("UserByScreenName")
+	if len(users) != 3 {
+		t.Fatalf("Expected one replay and then the feature on every request, got %d requests", len(users))
+	}
+
+	features := users[2]
+	if features["responsive_web_jetfuel_frame"] || !features["articles_preview_enabled"] {
+		t.Errorf("Expected the homepage's and then the built-in switch values, got %v", features)
+	}
+	if features["rweb_video_screen_enabled"] {
+		t.Error("The operation's override should win over the homepage")
+	}
+	if value, ok := features["rweb_new_enabled"]; !ok || value {
+		t.Errorf("The missing feature should be sent as false, got %v", features)
+	}
+
+	// Operations that sent no features share the same switch values
+	client.Followers(context.Background(), "11348282", 20)
+	if followers := requests("Followers"); len(followers) == 0 {
+		t.Fatal("Expected a Followers request")
+	} else if followers := followers[len(followers)-1]; len(followers) == 0 || followers["responsive_web_jetfuel_frame"] || !followers["rweb_video_screen_enabled"] {
+		t.Errorf("Followers should send the shared feature switches, got %v", followers)
+	}
+
+	// A feature that is still rejected after being added is not retried again
+	client.operations.Set(Operation{Name: "UsersByRestIds", QueryID: "1hjT2eXW1Zcw-2xk8EbvoA", Features: map[string]bool{"payments_enabled": false}})
+	mu.Lock()
+	sent["UsersByRestIds"] = nil
+	mu.Unlock()
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent["UsersByRestIds"] = append(sent["UsersByRestIds"], nil)
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"errors":[{"code":336,"message":"The following features cannot be null: rweb_other_enabled"}]}`)
+	})
+	if _, err := client.UsersByIDs(context.Background(), []string{"11348282"}); err == nil {
+		t.Error("Expected the validation error")
+	}
+	if n := len(requests("UsersByRestIds")); n != 2 {
+		t.Errorf("Expected a single replay, got %d requests", n)
+	}
+}
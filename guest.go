@@ -0,0 +1,109 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// BearerToken is the public web client bearer token used for guest and session requests
+const BearerToken = "AAAAAAAAAAAAAAAAAAAAANRILgAAAAAAnNwIzUejRCOuH5E6I8xnZz4puTs%3D1Zv7ttfk8LF81IUq16cHjhLTvJu4FA33AGWWjCpTnA"
+
+// API error codes that mean the guest token expired or was never valid
+var guestTokenErrorCodes = map[int]bool{
+	239: true, // Bad guest token
+}
+
+// ActivateGuestToken performs the guest activation exchange and returns a fresh guest token.
+//
+// It POSTs to 1.1/guest/activate.json on the configured API host with the public
+// bearer token. The client calls this automatically; it is exported for callers
+// that manage guest tokens themselves.
+func ActivateGuestToken(ctx context.Context, httpClient *http.Client, endpoints *Endpoints, userAgent string) (string, error) {
+	return activateGuestToken(ctx, httpClient, endpoints, &BrowserProfile{UserAgent: userAgent})
+}
+
+// activateGuestToken activates a guest token presenting the given browser profile
+func activateGuestToken(ctx context.Context, httpClient *http.Client, endpoints *Endpoints, profile *BrowserProfile) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoints.APIURL("1.1/guest/activate.json"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create guest activation request: %w", err)
+	}
+
+	req = profile.apply(req)
+	req.Header.Set("Authorization", "Bearer "+BearerToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to activate guest token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read guest activation response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("guest activation failed: %w", newResponseError("guest/activate", resp.StatusCode, body, resp.Header))
+	}
+
+	var result struct {
+		GuestToken string `json:"guest_token"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse guest activation response: %w", err)
+	}
+	if result.GuestToken == "" {
+		return "", fmt.Errorf("guest activation response has no guest_token")
+	}
+
+	return result.GuestToken, nil
+}
+
+// ensureGuestToken returns the identity's guest token, activating one if needed
+func (c *Client) ensureGuestToken(ctx context.Context, httpClient *http.Client, id *pooledIdentity) (string, error) {
+	id.guestMu.Lock()
+	defer id.guestMu.Unlock()
+
+	if id.guestToken != "" {
+		return id.guestToken, nil
+	}
+
+	token, err := activateGuestToken(ctx, httpClient, c.config.endpoints(), id.browserProfile())
+	if err != nil {
+		return "", err
+	}
+
+	if c.debugEnabled {
+		fmt.Printf("🔑 Activated guest token %s\n", token)
+	}
+
+	id.guestToken = token
+	return token, nil
+}
+
+// invalidateGuestToken drops the identity's guest token so its next request activates a new one
+func (c *Client) invalidateGuestToken(id *pooledIdentity) {
+	id.guestMu.Lock()
+	defer id.guestMu.Unlock()
+
+	id.guestToken = ""
+}
+
+// isGuestTokenError reports whether the server rejected the guest token
+func isGuestTokenError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, apiErr := range apiErrorsOf(err) {
+		if guestTokenErrorCodes[apiErr.Code] || strings.Contains(strings.ToLower(apiErr.Message), "guest token") {
+			return true
+		}
+	}
+	return false
+}
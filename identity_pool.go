@@ -0,0 +1,381 @@
+package xapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// IdentityKind distinguishes anonymous guest identities from logged-in sessions
+type IdentityKind string
+
+const (
+	IdentityGuest   IdentityKind = "guest"   // Guest token identity
+	IdentitySession IdentityKind = "session" // Logged-in account identity
+)
+
+// IdentityPoolConfig configures the identities a single Client spreads requests across.
+//
+// Each request is assigned to the healthiest identity that still has rate limit
+// budget for the operation. Identities that receive a 429 or 401 are benched for
+// a cooldown and only used again once every other identity is unavailable.
+//
+// Example:
+//
+//	config := xapi.DefaultProductionConfig()
+//	config.Identities = &xapi.IdentityPoolConfig{
+//	    Sessions: []*xapi.Session{account1, account2},
+//	    Guests:   4,
+//	}
+//	client, err := xapi.NewClient(config)
+type IdentityPoolConfig struct {
+	Sessions          []*Session        // Logged-in accounts, added after ProductionConfig.Session
+	Guests            int               // Number of guest identities
+	Profiles          []*BrowserProfile // Browser profiles assigned round-robin to identities without a session profile
+	RateLimitCooldown time.Duration     // Bench time after a 429 without a reset header (0 uses 15 minutes)
+	AuthCooldown      time.Duration     // Bench time after a 401 (0 uses 10 minutes)
+}
+
+// Default bench times when IdentityPoolConfig leaves them unset
+const (
+	defaultRateLimitCooldown = 15 * time.Minute
+	defaultAuthCooldown      = 10 * time.Minute
+)
+
+// healthAlpha weights the latest outcome in an identity's health score
+const healthAlpha = 0.2
+
+// IdentityStats reports the health and usage of one pooled identity
+type IdentityStats struct {
+	Name         string                    `json:"name"`
+	Kind         IdentityKind              `json:"kind"`
+	Profile      string                    `json:"profile"`  // Browser profile name
+	Health       float64                   `json:"health"`   // Moving average of request success, 0-1
+	Requests     int64                     `json:"requests"` // Requests the circuit breaker let through
+	Successes    int64                     `json:"successes"`
+	Failures     int64                     `json:"failures"`
+	RateLimited  int64                     `json:"rate_limited"`
+	AuthFailures int64                     `json:"auth_failures"`
+	BenchedUntil time.Time                 `json:"benched_until,omitempty"`
+	LastUsed     time.Time                 `json:"last_used,omitempty"`
+	RateLimits   map[string]RateLimitState `json:"rate_limits,omitempty"`
+}
+
+// Benched reports whether the identity is cooling down after a 429 or 401
+func (s IdentityStats) Benched(now time.Time) bool {
+	return now.Before(s.BenchedUntil)
+}
+
+// pooledIdentity is one guest or session identity with its own token,
+// cookies and rate limit windows
+type pooledIdentity struct {
+	label   string            // Fallback name for sessions without a twid cookie
+	profile *BrowserProfile   // Browser presented unless the session has its own profile
+	limiter *operationLimiter // Per-operation limits reported for this identity
+	proxy   *egressProxy      // Pinned proxy, guarded by proxySet.mu
+
+	guestMu    sync.Mutex // Guards the guest ID and guest token activation
+	guestID    string
+	guestToken string
+
+	sessionMu sync.RWMutex
+	session   *Session // nil for guest identities
+
+	// Guarded by identityPool.mu
+	stats IdentityStats
+}
+
+func newPooledIdentity(guestID, label string, session *Session, profile *BrowserProfile) *pooledIdentity {
+	return &pooledIdentity{
+		guestID: guestID,
+		label:   label,
+		profile: profile,
+		limiter: newOperationLimiter(),
+		session: session,
+		stats:   IdentityStats{Health: 1},
+	}
+}
+
+// name returns the key used for circuit breakers and stats
+func (id *pooledIdentity) name() string {
+	session := id.currentSession()
+	if session == nil {
+		return id.currentGuestID()
+	}
+	if name := session.identity(); name != "session" || id.label == "" {
+		return name
+	}
+	return id.label
+}
+
+// browserProfile returns the profile every request from the identity presents:
+// the session's own profile if it has one, else the one assigned by the pool
+func (id *pooledIdentity) browserProfile() *BrowserProfile {
+	id.sessionMu.RLock()
+	defer id.sessionMu.RUnlock()
+
+	if id.session != nil && id.session.Profile != nil {
+		return id.session.Profile
+	}
+	return id.profile
+}
+
+// currentGuestID returns the guest ID sent in the guest_id cookie and XPFF header
+func (id *pooledIdentity) currentGuestID() string {
+	id.guestMu.Lock()
+	defer id.guestMu.Unlock()
+	return id.guestID
+}
+
+// resetGuest gives the identity a new guest ID and drops its guest token
+func (id *pooledIdentity) resetGuest() {
+	id.guestMu.Lock()
+	defer id.guestMu.Unlock()
+	id.guestID = generateGuestID()
+	id.guestToken = ""
+}
+
+// currentSession returns a copy of the identity's session, or nil for guests
+func (id *pooledIdentity) currentSession() *Session {
+	id.sessionMu.RLock()
+	defer id.sessionMu.RUnlock()
+
+	if id.session == nil {
+		return nil
+	}
+	copied := *id.session
+	return &copied
+}
+
+// identityPool assigns requests to identities and tracks their health
+type identityPool struct {
+	config     *IdentityPoolConfig
+	mu         sync.Mutex
+	identities []*pooledIdentity
+}
+
+// newIdentityPool builds the pool from the client configuration. Without
+// Identities the pool holds a single identity: Session if set, else a guest.
+func newIdentityPool(config *ProductionConfig) (*identityPool, error) {
+	poolConfig := config.Identities
+	if poolConfig == nil {
+		poolConfig = &IdentityPoolConfig{}
+	}
+
+	var sessions []*Session
+	if config.Session != nil {
+		sessions = append(sessions, config.Session)
+	}
+	sessions = append(sessions, poolConfig.Sessions...)
+
+	// Without explicit identities there is one guest per proxy
+	guests := poolConfig.Guests
+	if len(sessions) == 0 && guests == 0 {
+		guests = 1
+		if config.ProxyPool != nil && len(config.ProxyPool.URLs) > 1 {
+			guests = len(config.ProxyPool.URLs)
+		}
+	}
+
+	// Identities take turns through the configured profiles
+	profiles := config.identityProfiles()
+	for i, profile := range profiles {
+		if profile == nil || profile.UserAgent == "" {
+			return nil, fmt.Errorf("identity pool: profile %d has no user agent", i)
+		}
+	}
+
+	pool := &identityPool{config: poolConfig}
+	used := make(map[string]bool)
+	for i, session := range sessions {
+		if session == nil {
+			return nil, fmt.Errorf("identity pool: session %d is nil", i)
+		}
+		if err := session.Validate(); err != nil {
+			return nil, fmt.Errorf("identity pool: session %d: %w", i, err)
+		}
+		copied := *session
+		profile := profiles[len(pool.identities)%len(profiles)]
+		id := newPooledIdentity(uniqueGuestID(used), fmt.Sprintf("session:%d", i), &copied, profile)
+		pool.identities = append(pool.identities, id)
+	}
+	for i := 0; i < guests; i++ {
+		profile := profiles[len(pool.identities)%len(profiles)]
+		pool.identities = append(pool.identities, newPooledIdentity(uniqueGuestID(used), "", nil, profile))
+	}
+
+	return pool, nil
+}
+
+// identityProfiles returns the browser profiles pooled identities take turns
+// through: IdentityPoolConfig.Profiles, else the configured BrowserProfile
+func (c *ProductionConfig) identityProfiles() []*BrowserProfile {
+	if c.Identities != nil && len(c.Identities.Profiles) > 0 {
+		return c.Identities.Profiles
+	}
+	return []*BrowserProfile{c.browserProfile()}
+}
+
+// uniqueGuestID generates a guest ID not yet used by the pool
+func uniqueGuestID(used map[string]bool) string {
+	for {
+		guestID := generateGuestID()
+		if !used[guestID] {
+			used[guestID] = true
+			return guestID
+		}
+	}
+}
+
+// primary returns the first identity, which Session and SetSession operate on
+func (p *identityPool) primary() *pooledIdentity {
+	return p.identities[0]
+}
+
+// acquire picks the identity for the next request to an operation: the one
+// available soonest (not benched and with budget left), then the healthiest,
+// then the least recently used
+func (p *identityPool) acquire(operation string) *pooledIdentity {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var best *pooledIdentity
+	var bestAvailable time.Time
+	for _, id := range p.identities {
+		available := now
+		if id.stats.Benched(now) {
+			available = id.stats.BenchedUntil
+		}
+		if reset, paused := id.limiter.pausedUntil(operation, now); paused && reset.After(available) {
+			available = reset
+		}
+
+		if best == nil || available.Before(bestAvailable) ||
+			(available.Equal(bestAvailable) && id.preferredOver(best)) {
+			best, bestAvailable = id, available
+		}
+	}
+
+	best.stats.LastUsed = now
+	return best
+}
+
+// begin counts a request an identity sends, once the circuit breaker has let it through
+func (p *identityPool) begin(id *pooledIdentity) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id.stats.Requests++
+}
+
+// preferredOver ranks two equally available identities. The caller must hold identityPool.mu.
+func (id *pooledIdentity) preferredOver(other *pooledIdentity) bool {
+	if id.stats.Health != other.stats.Health {
+		return id.stats.Health > other.stats.Health
+	}
+	return id.stats.LastUsed.Before(other.stats.LastUsed)
+}
+
+// record updates an identity's health with the outcome of a request and
+// benches it after a 429 or 401
+func (p *identityPool) record(id *pooledIdentity, err error) {
+	// Cancellations and local pauses say nothing about the identity, as for the breaker
+	if isNeutralForBreaker(err) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := &id.stats
+	if !countsAsBreakerFailure(err) {
+		stats.Successes++
+		stats.Health = (1-healthAlpha)*stats.Health + healthAlpha
+		return
+	}
+
+	stats.Failures++
+	stats.Health = (1 - healthAlpha) * stats.Health
+
+	var rateErr *RateLimitError
+	var authErr *AuthError
+	switch {
+	case errors.As(err, &rateErr):
+		stats.RateLimited++
+		until := rateErr.Reset
+		if until.IsZero() && rateErr.RetryAfter > 0 {
+			until = now.Add(rateErr.RetryAfter)
+		}
+		if until.IsZero() {
+			until = now.Add(p.rateLimitCooldown())
+		}
+		p.bench(id, until)
+
+	case errors.As(err, &authErr) && authErr.StatusCode == http.StatusUnauthorized:
+		stats.AuthFailures++
+		p.bench(id, now.Add(p.authCooldown()))
+	}
+}
+
+// bench keeps an identity out of rotation until the given time. The caller must hold p.mu.
+func (p *identityPool) bench(id *pooledIdentity, until time.Time) {
+	if until.After(id.stats.BenchedUntil) {
+		id.stats.BenchedUntil = until
+	}
+}
+
+func (p *identityPool) rateLimitCooldown() time.Duration {
+	if p.config.RateLimitCooldown > 0 {
+		return p.config.RateLimitCooldown
+	}
+	return defaultRateLimitCooldown
+}
+
+func (p *identityPool) authCooldown() time.Duration {
+	if p.config.AuthCooldown > 0 {
+		return p.config.AuthCooldown
+	}
+	return defaultAuthCooldown
+}
+
+// stats returns a snapshot of every identity, healthiest first
+func (p *identityPool) stats() []IdentityStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]IdentityStats, 0, len(p.identities))
+	for _, id := range p.identities {
+		snapshot := id.stats
+		snapshot.Name = id.name()
+		snapshot.Profile = id.browserProfile().Name
+		snapshot.Kind = IdentityGuest
+		if id.currentSession() != nil {
+			snapshot.Kind = IdentitySession
+		}
+		if limits := id.limiter.status(); len(limits) > 0 {
+			snapshot.RateLimits = limits
+		}
+		stats = append(stats, snapshot)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Health > stats[j].Health
+	})
+	return stats
+}
+
+// IdentityStats returns the health, usage and rate limit budget of every identity
+// in the client's pool, healthiest first.
+//
+// Example:
+//
+//	for _, id := range client.IdentityStats() {
+//	    fmt.Printf("%s (%s): health %.2f, benched=%v\n", id.Name, id.Kind, id.Health, id.Benched(time.Now()))
+//	}
+func (c *Client) IdentityStats() []IdentityStats {
+	return c.identities.stats()
+}
@@ -0,0 +1,176 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// keyMaterialVersion is bumped whenever the stored layout or derivation changes,
+// so stale files from older versions are ignored instead of misread
+const keyMaterialVersion = 1
+
+// KeyMaterial is the transaction key material fetched from the homepage and
+// the ondemand.s bundle, together with the values derived from it
+type KeyMaterial struct {
+	Version            int       `json:"version"`
+	Source             string    `json:"source"` // Homepage URL the material was fetched from
+	HomePageHTML       string    `json:"home_page_html"`
+	OnDemandFileHTML   string    `json:"ondemand_file_html"`
+	Key                string    `json:"key"` // twitter-site-verification value
+	KeyBytes           []int     `json:"key_bytes"`
+	RowIndex           int       `json:"row_index"`
+	KeyBytesIndices    []int     `json:"key_bytes_indices"`
+	AnimationKey       string    `json:"animation_key"`
+	FetchedAt          time.Time `json:"fetched_at"`
+	HTMLExpiresAt      time.Time `json:"html_expires_at"`
+	AnimationExpiresAt time.Time `json:"animation_expires_at"`
+}
+
+// Expired reports whether any part of the material has outlived its cache lifetime
+func (m *KeyMaterial) Expired(now time.Time) bool {
+	return now.After(m.HTMLExpiresAt) || now.After(m.AnimationExpiresAt)
+}
+
+// KeyMaterialStore persists transaction key material between processes so
+// short-lived programs can skip the homepage and ondemand.s downloads.
+// Load returns nil without error when nothing has been stored yet.
+type KeyMaterialStore interface {
+	Load(ctx context.Context) (*KeyMaterial, error)
+	Save(ctx context.Context, material *KeyMaterial) error
+}
+
+// FileKeyMaterialStore stores key material as JSON in a single file.
+//
+// Reads take a shared lock and writes an exclusive lock on a sibling ".lock"
+// file, and writes replace the file atomically, so several processes on one
+// host can share the same path.
+//
+// Example:
+//
+//	config := xapi.DefaultProductionConfig()
+//	config.KeyMaterialStore = xapi.NewFileKeyMaterialStore(xapi.DefaultKeyMaterialPath())
+//	client, err := xapi.NewClient(config)
+type FileKeyMaterialStore struct {
+	path string
+}
+
+// NewFileKeyMaterialStore returns a store backed by the file at path.
+// The file and its directory are created on the first Save.
+func NewFileKeyMaterialStore(path string) *FileKeyMaterialStore {
+	return &FileKeyMaterialStore{path: path}
+}
+
+// DefaultKeyMaterialPath returns the per-user cache location for key material,
+// falling back to the temp directory when no cache directory is available
+func DefaultKeyMaterialPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "xapi", "key-material.json")
+}
+
+// Path returns the file the store reads and writes
+func (s *FileKeyMaterialStore) Path() string {
+	return s.path
+}
+
+// Load reads the stored key material, or returns nil if the file does not exist
+func (s *FileKeyMaterialStore) Load(ctx context.Context) (*KeyMaterial, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lock(false)
+	if errors.Is(err, os.ErrNotExist) {
+		// Never saved through a store, so there is no writer to wait for
+		unlock, err = func() {}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key material: %w", err)
+	}
+
+	var material KeyMaterial
+	if err := json.Unmarshal(data, &material); err != nil {
+		return nil, fmt.Errorf("failed to parse key material %s: %w", s.path, err)
+	}
+	return &material, nil
+}
+
+// Save writes the key material, replacing the file atomically
+func (s *FileKeyMaterialStore) Save(ctx context.Context, material *KeyMaterial) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(material)
+	if err != nil {
+		return fmt.Errorf("failed to encode key material: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create key material directory: %w", err)
+	}
+
+	unlock, err := s.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create key material file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key material: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key material: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace key material: %w", err)
+	}
+	return nil
+}
+
+// lock takes a shared or exclusive lock on the sibling lock file. A shared
+// lock is not created if missing, so loading never writes to disk.
+func (s *FileKeyMaterialStore) lock(exclusive bool) (func(), error) {
+	flags := os.O_RDONLY
+	if exclusive {
+		flags = os.O_RDWR | os.O_CREATE
+	}
+
+	f, err := os.OpenFile(s.path+".lock", flags, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open key material lock: %w", err)
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock key material: %w", err)
+	}
+
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
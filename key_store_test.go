@@ -0,0 +1,117 @@
+package xapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyMaterialWarmStart(t *testing.T) {
+	server := newStandIn(t)
+	store := NewFileKeyMaterialStore(filepath.Join(t.TempDir(), "xapi", "key-material.json"))
+
+	config := server.config()
+	config.KeyMaterialStore = store
+
+	cold, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	if server.homeFetches.Load() != 1 {
+		t.Fatalf("Cold start should fetch the homepage once, got %d", server.homeFetches.Load())
+	}
+	if _, err := os.Stat(store.Path()); err != nil {
+		t.Fatalf("Key material should be persisted: %v", err)
+	}
+
+	warm, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	if server.homeFetches.Load() != 1 {
+		t.Errorf("Warm start should not fetch the homepage, got %d fetches", server.homeFetches.Load())
+	}
+	if warm.GetMetrics().StoreHits != 1 {
+		t.Errorf("Expected a store hit, got %+v", warm.GetMetrics())
+	}
+
+	coldStats, warmStats := cold.GetStats(), warm.GetStats()
+	if coldStats.AnimationKey != warmStats.AnimationKey || coldStats.KeyLength != warmStats.KeyLength ||
+		coldStats.IndicesCount != warmStats.IndicesCount || !coldStats.LastFetchTime.Equal(warmStats.LastFetchTime) {
+		t.Errorf("Warm start should restore the same key material: %+v vs %+v", coldStats, warmStats)
+	}
+	if _, err := warm.Generate("GET", "/graphql/test"); err != nil {
+		t.Errorf("Warm generator should generate IDs: %v", err)
+	}
+
+	// Expired material is ignored and replaced
+	material, _ := store.Load(context.Background())
+	material.AnimationExpiresAt = time.Now().Add(-time.Minute)
+	if err := store.Save(context.Background(), material); err != nil {
+		t.Fatalf("Failed to save material: %v", err)
+	}
+	if _, err := NewTransactionGeneratorWithConfig(config); err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	if server.homeFetches.Load() != 2 {
+		t.Errorf("Expired material should be refetched, got %d fetches", server.homeFetches.Load())
+	}
+	if material, _ := store.Load(context.Background()); material.Expired(time.Now()) {
+		t.Error("Refetched material should replace the expired file")
+	}
+
+	// Material fetched from another homepage is never used
+	config.Endpoints = EndpointsFor(newStandIn(t).URL)
+	other, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	if other.GetMetrics().StoreHits != 0 {
+		t.Error("Material for a different homepage should be ignored")
+	}
+}
+
+func TestFileKeyMaterialStoreConcurrency(t *testing.T) {
+	store := NewFileKeyMaterialStore(filepath.Join(t.TempDir(), "key-material.json"))
+	ctx := context.Background()
+
+	if material, err := store.Load(ctx); material != nil || err != nil {
+		t.Fatalf("Empty store should load nil, got %v, %v", material, err)
+	}
+
+	// Writers and readers from separate handles must never observe a partial file
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			material := &KeyMaterial{
+				Version:      keyMaterialVersion,
+				HomePageHTML: string(make([]byte, 64*1024)),
+				KeyBytes:     []int{i},
+				AnimationKey: "key",
+			}
+			if err := store.Save(ctx, material); err != nil {
+				t.Errorf("Save failed: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := NewFileKeyMaterialStore(store.Path()).Load(ctx); err != nil {
+				t.Errorf("Load observed a broken file: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	material, err := store.Load(ctx)
+	if err != nil || material == nil || len(material.KeyBytes) != 1 {
+		t.Fatalf("Expected a complete material after concurrent writes, got %+v, %v", material, err)
+	}
+	if matches, _ := filepath.Glob(store.Path() + ".*.tmp"); len(matches) != 0 {
+		t.Errorf("Temporary files should be cleaned up: %v", matches)
+	}
+}
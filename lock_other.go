@@ -0,0 +1,16 @@
+//go:build !unix
+
+package xapi
+
+import "os"
+
+// lockFile is a no-op where flock is unavailable; stores still replace files
+// atomically, so readers never see a partial write
+func lockFile(f *os.File, exclusive bool) error {
+	return nil
+}
+
+// unlockFile releases a lock taken with lockFile
+func unlockFile(f *os.File) error {
+	return nil
+}
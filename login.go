@@ -0,0 +1,386 @@
+package xapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+// Onboarding subtask IDs handled by the login flow
+const (
+	SubtaskJSInstrumentation       = "LoginJsInstrumentationSubtask"
+	SubtaskEnterUserIdentifier     = "LoginEnterUserIdentifierSSO"
+	SubtaskEnterPassword           = "LoginEnterPassword"
+	SubtaskAccountDuplicationCheck = "AccountDuplicationCheck"
+	SubtaskTwoFactorAuthChallenge  = "LoginTwoFactorAuthChallenge"
+	SubtaskLoginSuccess            = "LoginSuccessSubtask"
+	SubtaskDenyLogin               = "DenyLoginSubtask"
+)
+
+// maxLoginSteps bounds the flow in case the server keeps issuing subtasks
+const maxLoginSteps = 16
+
+// LoginCredentials are the inputs to the username/password login flow
+type LoginCredentials struct {
+	Username   string // Username, email or phone number
+	Password   string // Account password
+	TOTPSecret string // Base32 TOTP secret, required if the account uses app-based 2FA
+}
+
+// LoginError is returned when the login flow fails at a specific subtask
+type LoginError struct {
+	Subtask string // Subtask being answered when the flow failed
+	Err     error  // Underlying error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("login failed at %s: %v", e.Subtask, e.Err)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// LoginStep answers one onboarding subtask
+type LoginStep interface {
+	// SubtaskID returns the subtask this step answers
+	SubtaskID() string
+	// SubtaskInput returns the subtask_inputs entry sent to task.json
+	SubtaskInput() map[string]interface{}
+}
+
+// JSInstrumentationStep answers LoginJsInstrumentationSubtask with an empty instrumentation result
+type JSInstrumentationStep struct{}
+
+func (JSInstrumentationStep) SubtaskID() string { return SubtaskJSInstrumentation }
+
+func (s JSInstrumentationStep) SubtaskInput() map[string]interface{} {
+	return map[string]interface{}{
+		"subtask_id": s.SubtaskID(),
+		"js_instrumentation": map[string]interface{}{
+			"response": "{}",
+			"link":     "next_link",
+		},
+	}
+}
+
+// EnterUserIdentifierStep answers LoginEnterUserIdentifierSSO with a username, email or phone
+type EnterUserIdentifierStep struct {
+	Identifier string
+}
+
+func (EnterUserIdentifierStep) SubtaskID() string { return SubtaskEnterUserIdentifier }
+
+func (s EnterUserIdentifierStep) SubtaskInput() map[string]interface{} {
+	return map[string]interface{}{
+		"subtask_id": s.SubtaskID(),
+		"settings_list": map[string]interface{}{
+			"setting_responses": []interface{}{
+				map[string]interface{}{
+					"key": "user_identifier",
+					"response_data": map[string]interface{}{
+						"text_data": map[string]interface{}{"result": s.Identifier},
+					},
+				},
+			},
+			"link": "next_link",
+		},
+	}
+}
+
+// EnterPasswordStep answers LoginEnterPassword
+type EnterPasswordStep struct {
+	Password string
+}
+
+func (EnterPasswordStep) SubtaskID() string { return SubtaskEnterPassword }
+
+func (s EnterPasswordStep) SubtaskInput() map[string]interface{} {
+	return map[string]interface{}{
+		"subtask_id": s.SubtaskID(),
+		"enter_password": map[string]interface{}{
+			"password": s.Password,
+			"link":     "next_link",
+		},
+	}
+}
+
+// AccountDuplicationCheckStep answers AccountDuplicationCheck by declining to reuse a logged-in account
+type AccountDuplicationCheckStep struct{}
+
+func (AccountDuplicationCheckStep) SubtaskID() string { return SubtaskAccountDuplicationCheck }
+
+func (s AccountDuplicationCheckStep) SubtaskInput() map[string]interface{} {
+	return map[string]interface{}{
+		"subtask_id": s.SubtaskID(),
+		"check_logged_in_account": map[string]interface{}{
+			"link": "AccountDuplicationCheck_false",
+		},
+	}
+}
+
+// TwoFactorAuthStep answers LoginTwoFactorAuthChallenge with a one-time code
+type TwoFactorAuthStep struct {
+	Code string
+}
+
+func (TwoFactorAuthStep) SubtaskID() string { return SubtaskTwoFactorAuthChallenge }
+
+func (s TwoFactorAuthStep) SubtaskInput() map[string]interface{} {
+	return map[string]interface{}{
+		"subtask_id": s.SubtaskID(),
+		"enter_text": map[string]interface{}{
+			"text": s.Code,
+			"link": "next_link",
+		},
+	}
+}
+
+// loginStepFor maps a subtask issued by the server to the step that answers it
+func loginStepFor(subtaskID string, creds LoginCredentials, now time.Time) (LoginStep, error) {
+	switch subtaskID {
+	case SubtaskJSInstrumentation:
+		return JSInstrumentationStep{}, nil
+	case SubtaskEnterUserIdentifier:
+		return EnterUserIdentifierStep{Identifier: creds.Username}, nil
+	case SubtaskEnterPassword:
+		return EnterPasswordStep{Password: creds.Password}, nil
+	case SubtaskAccountDuplicationCheck:
+		return AccountDuplicationCheckStep{}, nil
+	case SubtaskTwoFactorAuthChallenge:
+		if creds.TOTPSecret == "" {
+			return nil, fmt.Errorf("two-factor challenge requires a TOTP secret")
+		}
+		code, err := GenerateTOTP(creds.TOTPSecret, now)
+		if err != nil {
+			return nil, err
+		}
+		return TwoFactorAuthStep{Code: code}, nil
+	case SubtaskDenyLogin:
+		return nil, fmt.Errorf("login denied by server")
+	default:
+		return nil, fmt.Errorf("unsupported subtask %s", subtaskID)
+	}
+}
+
+// taskResponse is the relevant part of an onboarding/task.json response
+type taskResponse struct {
+	FlowToken string     `json:"flow_token"`
+	Status    string     `json:"status"`
+	Errors    []APIError `json:"errors"`
+	Subtasks  []struct {
+		SubtaskID string `json:"subtask_id"`
+	} `json:"subtasks"`
+}
+
+// loginFlow carries the state of one onboarding run
+type loginFlow struct {
+	http       *http.Client
+	endpoints  *Endpoints
+	profile    *BrowserProfile
+	guestToken string
+	jar        http.CookieJar
+}
+
+// Login runs the onboarding/task.json login flow and returns an authenticated session.
+//
+// The flow activates a guest token, then answers each subtask the server issues
+// (JS instrumentation, user identifier, password, account duplication check and,
+// with a TOTP secret, the two-factor challenge) until login succeeds.
+//
+// Example:
+//
+//	session, err := xapi.Login(ctx, nil, xapi.LoginCredentials{
+//	    Username:   "myaccount",
+//	    Password:   os.Getenv("X_PASSWORD"),
+//	    TOTPSecret: os.Getenv("X_TOTP_SECRET"),
+//	})
+func Login(ctx context.Context, config *ProductionConfig, creds LoginCredentials) (*Session, error) {
+	if config == nil {
+		config = DefaultProductionConfig()
+	}
+	httpClient, proxies, err := config.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// Log in as the pool's first identity would: with its browser profile,
+	// keeping the whole flow on the proxy it is pinned to
+	profile := config.identityProfiles()[0]
+	if profile == nil || profile.UserAgent == "" {
+		return nil, fmt.Errorf("login: profile 0 has no user agent")
+	}
+	id := newPooledIdentity(generateGuestID(), "", nil, profile)
+	if proxy := proxies.assign(id); proxy != nil {
+		httpClient = proxy.client
+	}
+	return login(ctx, httpClient, config.endpoints(), id.browserProfile(), creds)
+}
+
+// Login runs the login flow with the client's transport and endpoints, then
+// switches the client to the resulting session
+func (c *Client) Login(ctx context.Context, creds LoginCredentials) error {
+	primary := c.identities.primary()
+	session, err := login(ctx, c.httpFor(primary), c.config.endpoints(), primary.browserProfile(), creds)
+	if err != nil {
+		return err
+	}
+	return c.SetSession(session)
+}
+
+// login runs the flow presenting the given browser profile, which the session keeps
+func login(ctx context.Context, httpClient *http.Client, endpoints *Endpoints, profile *BrowserProfile, creds LoginCredentials) (*Session, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The flow needs its own cookie jar for att, ct0 and auth_token
+	flowClient := *httpClient
+	flowClient.Jar = jar
+
+	guestToken, err := activateGuestToken(ctx, &flowClient, endpoints, profile)
+	if err != nil {
+		return nil, &LoginError{Subtask: "guest activation", Err: err}
+	}
+
+	flow := &loginFlow{
+		http:       &flowClient,
+		endpoints:  endpoints,
+		profile:    profile,
+		guestToken: guestToken,
+		jar:        jar,
+	}
+
+	resp, err := flow.start(ctx)
+	if err != nil {
+		return nil, &LoginError{Subtask: "flow start", Err: err}
+	}
+
+	for i := 0; i < maxLoginSteps; i++ {
+		if len(resp.Subtasks) == 0 {
+			break
+		}
+
+		subtaskID := resp.Subtasks[0].SubtaskID
+		if subtaskID == SubtaskLoginSuccess {
+			break
+		}
+
+		step, err := loginStepFor(subtaskID, creds, time.Now())
+		if err != nil {
+			return nil, &LoginError{Subtask: subtaskID, Err: err}
+		}
+
+		resp, err = flow.submit(ctx, resp.FlowToken, step)
+		if err != nil {
+			return nil, &LoginError{Subtask: subtaskID, Err: err}
+		}
+	}
+
+	session := flow.session()
+	if err := session.Validate(); err != nil {
+		return nil, &LoginError{Subtask: SubtaskLoginSuccess, Err: err}
+	}
+	return session, nil
+}
+
+// start begins the login flow
+func (f *loginFlow) start(ctx context.Context) (*taskResponse, error) {
+	body := map[string]interface{}{
+		"input_flow_data": map[string]interface{}{
+			"flow_context": map[string]interface{}{
+				"debug_overrides": map[string]interface{}{},
+				"start_location":  map[string]interface{}{"location": "splash_screen"},
+			},
+		},
+		"subtask_versions": map[string]interface{}{},
+	}
+	return f.post(ctx, "1.1/onboarding/task.json?flow_name=login", body)
+}
+
+// submit answers one subtask
+func (f *loginFlow) submit(ctx context.Context, flowToken string, step LoginStep) (*taskResponse, error) {
+	body := map[string]interface{}{
+		"flow_token":     flowToken,
+		"subtask_inputs": []interface{}{step.SubtaskInput()},
+	}
+	return f.post(ctx, "1.1/onboarding/task.json", body)
+}
+
+// post sends one task.json request
+func (f *loginFlow) post(ctx context.Context, path string, body interface{}) (*taskResponse, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", f.endpoints.APIURL(path), bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task request: %w", err)
+	}
+
+	req = f.profile.apply(req)
+	req.Header.Set("Authorization", "Bearer "+BearerToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Guest-Token", f.guestToken)
+	req.Header.Set("X-Twitter-Active-User", "yes")
+	req.Header.Set("X-Twitter-Client-Language", "en")
+	if ct0 := f.cookie("ct0"); ct0 != "" {
+		req.Header.Set("X-Csrf-Token", ct0)
+	}
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newResponseError("onboarding/task", resp.StatusCode, respBody, resp.Header)
+	}
+
+	var result taskResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse task response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, &GraphQLError{StatusCode: resp.StatusCode, Errors: result.Errors}
+	}
+	return &result, nil
+}
+
+// cookie returns a cookie set on the API host during the flow
+func (f *loginFlow) cookie(name string) string {
+	u, err := url.Parse(f.endpoints.APIURL(""))
+	if err != nil {
+		return ""
+	}
+	for _, cookie := range f.jar.Cookies(u) {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// session builds a Session from the cookies issued during the flow
+func (f *loginFlow) session() *Session {
+	return &Session{
+		AuthToken: f.cookie("auth_token"),
+		CSRFToken: f.cookie("ct0"),
+		TwID:      f.cookie("twid"),
+		Profile:   f.profile,
+	}
+}
@@ -0,0 +1,168 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	// RFC 6238 appendix B vectors for the ASCII secret "12345678901234567890", truncated to 6 digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unix, want := range vectors {
+		got, err := GenerateTOTP(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTOTP failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("TOTP at %d = %s, want %s", unix, got, want)
+		}
+	}
+
+	// Authenticator apps show secrets lowercased and grouped
+	got, _ := GenerateTOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq", time.Unix(59, 0))
+	if got != "287082" {
+		t.Errorf("Normalized secret gave %s", got)
+	}
+
+	if _, err := GenerateTOTP("not base32!", time.Now()); err == nil {
+		t.Error("Invalid secret should fail")
+	}
+}
+
+// loginServer is a mocked task.json endpoint that walks through the login subtasks
+func loginServer(t *testing.T, totpSecret string) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	var answered []string
+	sequence := []string{
+		SubtaskJSInstrumentation,
+		SubtaskEnterUserIdentifier,
+		SubtaskEnterPassword,
+		SubtaskAccountDuplicationCheck,
+		SubtaskTwoFactorAuthChallenge,
+		SubtaskLoginSuccess,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/1.1/guest/activate.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"guest_token":"gt-login"}`)
+	})
+	mux.HandleFunc("/1.1/onboarding/task.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Guest-Token") != "gt-login" {
+			t.Errorf("task.json should carry the guest token")
+		}
+
+		var body struct {
+			FlowToken     string                   `json:"flow_token"`
+			SubtaskInputs []map[string]interface{} `json:"subtask_inputs"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+
+		next := 0
+		if r.URL.Query().Get("flow_name") == "login" {
+			http.SetCookie(w, &http.Cookie{Name: "att", Value: "att-token", Path: "/"})
+		} else {
+			if att, err := r.Cookie("att"); err != nil || att.Value != "att-token" {
+				t.Errorf("att cookie should be replayed")
+			}
+			input := body.SubtaskInputs[0]
+			subtask := input["subtask_id"].(string)
+			answered = append(answered, subtask)
+
+			switch subtask {
+			case SubtaskEnterUserIdentifier:
+				response := input["settings_list"].(map[string]interface{})["setting_responses"].([]interface{})[0].(map[string]interface{})
+				identifier := response["response_data"].(map[string]interface{})["text_data"].(map[string]interface{})["result"]
+				if identifier != "nasa" {
+					t.Errorf("Unexpected identifier %v", identifier)
+				}
+			case SubtaskEnterPassword:
+				if input["enter_password"].(map[string]interface{})["password"] != "hunter2" {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"errors":[{"code":399,"message":"Wrong password!"}]}`)
+					return
+				}
+			case SubtaskTwoFactorAuthChallenge:
+				want, _ := GenerateTOTP(totpSecret, time.Now())
+				if input["enter_text"].(map[string]interface{})["text"] != want {
+					t.Errorf("Unexpected 2FA code")
+				}
+				http.SetCookie(w, &http.Cookie{Name: "auth_token", Value: "auth-xyz", Path: "/"})
+				http.SetCookie(w, &http.Cookie{Name: "ct0", Value: "ct0-xyz", Path: "/"})
+				http.SetCookie(w, &http.Cookie{Name: "twid", Value: "u%3D11348282", Path: "/"})
+			}
+			next = len(answered)
+		}
+
+		fmt.Fprintf(w, `{"flow_token":"flow-%d","status":"success","subtasks":[{"subtask_id":%q}]}`, next, sequence[next])
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &answered
+}
+
+func TestLoginFlow(t *testing.T) {
+	secret := "JBSWY3DPEHPK3PXP"
+	server, answered := loginServer(t, secret)
+
+	config := DefaultProductionConfig()
+	config.Endpoints = EndpointsFor(server.URL)
+	safari := LookupBrowserProfile("safari-macos")
+	config.Identities = &IdentityPoolConfig{Profiles: []*BrowserProfile{safari, LookupBrowserProfile("chrome-windows")}}
+
+	session, err := Login(context.Background(), config, LoginCredentials{
+		Username:   "nasa",
+		Password:   "hunter2",
+		TOTPSecret: secret,
+	})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	if session.AuthToken != "auth-xyz" || session.CSRFToken != "ct0-xyz" || session.UserID() != "11348282" {
+		t.Errorf("Unexpected session: %+v", session)
+	}
+	if len(*answered) != 5 {
+		t.Errorf("Expected 5 answered subtasks, got %v", *answered)
+	}
+	if session.Profile != safari {
+		t.Errorf("Login should present the profile of the pool's first identity, got %+v", session.Profile)
+	}
+}
+
+func TestLoginFlowErrors(t *testing.T) {
+	server, _ := loginServer(t, "JBSWY3DPEHPK3PXP")
+	config := DefaultProductionConfig()
+	config.Endpoints = EndpointsFor(server.URL)
+	ctx := context.Background()
+
+	// Wrong password surfaces the API error at the password subtask
+	_, err := Login(ctx, config, LoginCredentials{Username: "nasa", Password: "wrong"})
+	var loginErr *LoginError
+	var httpErr *HTTPError
+	if !errors.As(err, &loginErr) || loginErr.Subtask != SubtaskEnterPassword || !errors.As(err, &httpErr) || httpErr.Errors[0].Code != 399 {
+		t.Errorf("Expected password LoginError, got %v", err)
+	}
+
+	// 2FA without a TOTP secret stops at the challenge
+	_, err = Login(ctx, config, LoginCredentials{Username: "nasa", Password: "hunter2"})
+	if !errors.As(err, &loginErr) || loginErr.Subtask != SubtaskTwoFactorAuthChallenge {
+		t.Errorf("Expected 2FA LoginError, got %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+package xapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Operation is one GraphQL operation the client calls: the query ID the web
+// app currently uses for it, the feature switches and field toggles sent
+// with every request and the operation's own feature overrides.
+type Operation struct {
+	Name         string          `json:"name"`
+	QueryID      string          `json:"query_id"`
+	Type         string          `json:"type,omitempty"`          // query or mutation
+	FieldToggles map[string]bool `json:"field_toggles,omitempty"` // Sent as the fieldToggles parameter
+
+	// Feature switches sent in the features parameter with the registry's
+	// values; discovery replaces them with the ones the bundle declares
+	FeatureSwitches []string `json:"feature_switches,omitempty"`
+
+	// Per-operation feature values that take precedence over the registry's
+	Features map[string]bool `json:"features,omitempty"`
+}
+
+// endpoint returns the operation's path below the GraphQL root
+func (op Operation) endpoint() string {
+	return op.QueryID + "/" + op.Name
+}
+
+// params returns request parameters with the features and the operation's
+// field toggles added, unless the caller already set them
+func (op Operation) params(params map[string]string, features map[string]bool) map[string]string {
+	out := make(map[string]string, len(params)+2)
+	for k, v := range params {
+		out[k] = v
+	}
+	if _, ok := out["features"]; !ok && len(features) > 0 {
+		features, _ := json.Marshal(features)
+		out["features"] = string(features)
+	}
+	if _, ok := out["fieldToggles"]; !ok && len(op.FieldToggles) > 0 {
+		toggles, _ := json.Marshal(op.FieldToggles)
+		out["fieldToggles"] = string(toggles)
+	}
+	return out
+}
+
+// clone returns a copy that shares no maps or slices with op
+func (op Operation) clone() Operation {
+	op.Features = cloneFlags(op.Features)
+	op.FieldToggles = cloneFlags(op.FieldToggles)
+	op.FeatureSwitches = append([]string(nil), op.FeatureSwitches...)
+	return op
+}
+
+func cloneFlags(flags map[string]bool) map[string]bool {
+	if flags == nil {
+		return nil
+	}
+	out := make(map[string]bool, len(flags))
+	for k, v := range flags {
+		out[k] = v
+	}
+	return out
+}
+
+// DefaultOperations returns the operations the client ships with. Query IDs
+// rotate with web app deployments; OperationRegistry discovery keeps them current.
+func DefaultOperations() []Operation {
+	switches := func(names []string) []string { return append([]string(nil), names...) }
+	return []Operation{
+		{Name: "UserByScreenName", QueryID: "ck5KkZ8t5cOmoLssopN99Q", Type: "query", FeatureSwitches: switches(userFeatureSwitches)},
+		{Name: "UserTweets", QueryID: "E8Wq-_jFSaU7hxVcuOPR9g", Type: "query", FeatureSwitches: switches(userFeatureSwitches)},
+		{Name: "TweetResultByRestId", QueryID: "qxWQxcMLiTPcavz9Qy5hwQ", Type: "query", FeatureSwitches: switches(timelineFeatureSwitches)},
+		{Name: "BroadcastQuery", QueryID: "BGhq0o90P-tPie4pyhqlVA", Type: "query"},
+		{Name: "UserHighlightsTweets", QueryID: "gmHw9geMTncZ7jeLLUUNOw", Type: "query", FeatureSwitches: switches(timelineFeatureSwitches)},
+		{Name: "Following", QueryID: "SaWqzw0TFAWMx1nXWjXoaQ", Type: "query", FeatureSwitches: switches(timelineFeatureSwitches)},
+		{Name: "Followers", QueryID: "i6PPdIMm1MO7CpAqjau7sw", Type: "query", FeatureSwitches: switches(timelineFeatureSwitches)},
+		{Name: "BlueVerifiedFollowers", QueryID: "fxEl9kp1Tgolqkq8_Lo3sg", Type: "query", FeatureSwitches: switches(timelineFeatureSwitches)},
+		{Name: "UserBusinessProfileTeamTimeline", QueryID: "zUBrgfL8uXdM3VR9TqHzNQ", Type: "query", FeatureSwitches: switches(timelineFeatureSwitches)},
+		{Name: "UsersByRestIds", QueryID: "1hjT2eXW1Zcw-2xk8EbvoA", Type: "query", FeatureSwitches: switches(usersFeatureSwitches)},
+	}
+}
+
+// OperationRegistry maps GraphQL operation names to their current query ID,
+// feature switches and field toggles. It starts from DefaultOperations and
+// refreshes itself from the main.*.js and api.*.js bundles the homepage
+// references, so rotated query IDs are picked up without a release. Feature
+// values come from one set of switches, updated from the homepage's
+// __INITIAL_STATE__, with each operation's overrides on top. It is safe for
+// concurrent use and may be shared between clients.
+//
+// Example:
+//
+//	client, _ := xapi.NewClient(nil)
+//	changed, err := client.DiscoverOperations(ctx)
+//	op, _ := client.Operations().Get("UserByScreenName")
+//	fmt.Println(changed, op.QueryID)
+type OperationRegistry struct {
+	mu           sync.RWMutex
+	operations   map[string]Operation
+	switches     map[string]bool // Feature switch values features are built from
+	discoveredAt time.Time
+
+	discoverMu  sync.Mutex // Serializes discovery
+	attemptedAt time.Time  // Start of the last discovery; guarded by discoverMu
+}
+
+// NewOperationRegistry returns a registry holding DefaultOperations
+func NewOperationRegistry() *OperationRegistry {
+	r := &OperationRegistry{operations: make(map[string]Operation), switches: cloneFlags(defaultFeatureSwitches)}
+	for _, op := range DefaultOperations() {
+		r.operations[op.Name] = op
+	}
+	return r
+}
+
+// Get returns a copy of the named operation
+func (r *OperationRegistry) Get(name string) (Operation, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	op, ok := r.operations[name]
+	return op.clone(), ok
+}
+
+// Set adds or replaces an operation, for example to pin a query ID
+func (r *OperationRegistry) Set(op Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations[op.Name] = op.clone()
+}
+
+// Operations returns copies of every operation sorted by name
+func (r *OperationRegistry) Operations() []Operation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ops := make([]Operation, 0, len(r.operations))
+	for _, op := range r.operations {
+		ops = append(ops, op.clone())
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Name < ops[j].Name })
+	return ops
+}
+
+// DiscoveredAt returns when operations were last discovered from the bundles
+func (r *OperationRegistry) DiscoveredAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.discoveredAt
+}
+
+// Update applies the operation definitions found in a JavaScript bundle and
+// returns the names of operations that were added or got a new query ID.
+// The bundle's feature switches replace an operation's, its overrides are
+// kept and field toggles the registry lacks are added as false.
+func (r *OperationRegistry) Update(bundleJS string) []string {
+	var changed []string
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, found := range parseOperations(bundleJS) {
+		op, known := r.operations[found.Name]
+		if !known || op.QueryID != found.QueryID {
+			changed = append(changed, found.Name)
+		}
+
+		op.Name, op.QueryID, op.Type = found.Name, found.QueryID, found.Type
+		if found.FeatureSwitches != nil {
+			op.FeatureSwitches = found.FeatureSwitches
+		}
+		for name := range found.FieldToggles {
+			if _, ok := op.FieldToggles[name]; !ok {
+				if op.FieldToggles == nil {
+					op.FieldToggles = make(map[string]bool)
+				}
+				op.FieldToggles[name] = false
+			}
+		}
+		r.operations[op.Name] = op
+	}
+	return changed
+}
+
+// Operation definitions in the web app bundles, e.g.
+// queryId:"…",operationName:"UserByScreenName",operationType:"query",metadata:{featureSwitches:[…],fieldToggles:[…]}
+var (
+	operationRegex = regexp.MustCompile(`queryId:\s*"([\w-]+)"\s*,\s*operationName:\s*"(\w+)"\s*,\s*operationType:\s*"(\w+)"` +
+		`(?:\s*,\s*metadata:\s*\{\s*featureSwitches:\s*\[([^\]]*)\](?:\s*,\s*fieldToggles:\s*\[([^\]]*)\])?)?`)
+	quotedNameRegex = regexp.MustCompile(`"(\w+)"`)
+)
+
+// parseOperations extracts the operation definitions from a bundle
+func parseOperations(bundleJS string) []Operation {
+	var ops []Operation
+	for _, m := range operationRegex.FindAllStringSubmatch(bundleJS, -1) {
+		op := Operation{Name: m[2], QueryID: m[1], Type: m[3]}
+		for _, name := range quotedNameRegex.FindAllStringSubmatch(m[4], -1) {
+			op.FeatureSwitches = append(op.FeatureSwitches, name[1])
+		}
+		for _, name := range quotedNameRegex.FindAllStringSubmatch(m[5], -1) {
+			if op.FieldToggles == nil {
+				op.FieldToggles = make(map[string]bool)
+			}
+			op.FieldToggles[name[1]] = false
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// Bundles that define GraphQL operations, as the homepage references them
+var (
+	mainBundleRegex = regexp.MustCompile(`responsive-web/client-web(?:-legacy)?/main\.[0-9a-f]+\.js`)
+	apiBundleRegex  = regexp.MustCompile(`["']api["']\s*:\s*["']([0-9a-f]+)["']`)
+)
+
+// bundleURLs returns the URLs of the operation bundles a homepage references
+func bundleURLs(homeHTML string, endpoints *Endpoints) []string {
+	var urls []string
+	if path := mainBundleRegex.FindString(homeHTML); path != "" {
+		urls = append(urls, endpoints.AssetURL(path))
+	}
+	if m := apiBundleRegex.FindStringSubmatch(homeHTML); m != nil {
+		urls = append(urls, endpoints.BundleURL("api", m[1]))
+	}
+	return urls
+}
+
+// operationRediscoveryInterval is the minimum time between discovery
+// attempts triggered by stale query IDs, so a missing operation cannot cause a
+// bundle download per request
+const operationRediscoveryInterval = time.Minute
+
+// isStaleQueryError reports whether err is the 404 GraphQL returns for an unknown query ID
+func isStaleQueryError(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound
+}
+
+// Operations returns the client's GraphQL operation registry
+func (c *Client) Operations() *OperationRegistry {
+	return c.operations
+}
+
+// DiscoverOperations refreshes the operation registry from the bundles
+// referenced by the homepage the transaction generator downloaded, and
+// returns the names of operations that were added or got a new query ID.
+func (c *Client) DiscoverOperations(ctx context.Context) ([]string, error) {
+	c.operations.discoverMu.Lock()
+	defer c.operations.discoverMu.Unlock()
+	return c.discoverOperations(ctx)
+}
+
+// discoverOperations fetches and applies the operation bundles. The caller
+// must hold the registry's discoverMu.
+func (c *Client) discoverOperations(ctx context.Context) ([]string, error) {
+	c.operations.attemptedAt = time.Now()
+
+	snapshot := c.txnGen.snapshot.Load()
+	if snapshot == nil {
+		if err := c.txnGen.refreshIfNeeded(ctx); err != nil {
+			return nil, fmt.Errorf("failed to fetch home page: %w", err)
+		}
+		if snapshot = c.txnGen.snapshot.Load(); snapshot == nil {
+			return nil, fmt.Errorf("no home page to discover operations from")
+		}
+	}
+
+	urls := bundleURLs(snapshot.homePageHTML, c.config.endpoints())
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no operation bundles referenced from the home page")
+	}
+
+	var changed []string
+	var errs []error
+	for _, u := range urls {
+		bundle, err := c.fetchBundle(ctx, u)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = append(changed, c.operations.Update(bundle)...)
+	}
+	if len(errs) == len(urls) {
+		return nil, errors.Join(errs...)
+	}
+
+	c.operations.mu.Lock()
+	c.operations.discoveredAt = time.Now()
+	c.operations.mu.Unlock()
+
+	if c.debugEnabled && len(changed) > 0 {
+		fmt.Printf("🔎 Discovered new query IDs for %v\n", changed)
+	}
+	return changed, nil
+}
+
+// fetchBundle downloads one JavaScript bundle as the primary identity
+func (c *Client) fetchBundle(ctx context.Context, bundleURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", bundleURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create bundle request: %w", err)
+	}
+	httpClient, profile := c.fetchTransport()
+	req = profile.apply(req)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch bundle: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch bundle %s: status %d", bundleURL, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle: %w", err)
+	}
+	return string(body), nil
+}
+
+// rediscover re-discovers operations after stale's query ID was rejected
+// and reports whether the registry now holds a different one. Concurrent
+// callers share one discovery, and discoveries are spaced by
+// operationRediscoveryInterval.
+func (c *Client) rediscover(ctx context.Context, stale Operation) bool {
+	c.operations.discoverMu.Lock()
+	defer c.operations.discoverMu.Unlock()
+
+	// Another request may already have found the new ID
+	if op, ok := c.operations.Get(stale.Name); ok && op.QueryID != stale.QueryID {
+		return true
+	}
+	if time.Since(c.operations.attemptedAt) < operationRediscoveryInterval {
+		return false
+	}
+
+	// A rotated query ID means a new deployment, so its homepage references new bundles
+	if !c.txnGen.staticSources {
+		if err := c.txnGen.Refresh(ctx); err != nil && c.debugEnabled {
+			fmt.Printf("⚠️ Home page refresh for operation discovery failed: %v\n", err)
+		}
+	}
+	if _, err := c.discoverOperations(ctx); err != nil {
+		if c.debugEnabled {
+			fmt.Printf("⚠️ Operation discovery failed: %v\n", err)
+		}
+		return false
+	}
+
+	op, ok := c.operations.Get(stale.Name)
+	return ok && op.QueryID != stale.QueryID
+}
+
+// query sends a registered GraphQL operation with its features and field
+// toggles. Two failures are repaired and the request replayed once each: a
+// 404 means the query ID was rotated, so operations are re-discovered, and
+// a validation error naming features that cannot be null adds them.
+func (c *Client) query(ctx context.Context, name string, params map[string]string) ([]byte, error) {
+	if _, ok := c.operations.Get(name); !ok {
+		return nil, fmt.Errorf("unknown GraphQL operation %q", name)
+	}
+	c.applyFeatureSwitches()
+
+	var rediscovered, featuresAdded bool
+	for {
+		op, _ := c.operations.Get(name)
+		body, err := c.request(ctx, "GET", op.endpoint(), op.params(params, c.operations.Features(name)))
+
+		switch missing := missingFeatures(err); {
+		case len(missing) > 0 && !featuresAdded && c.operations.addFeatureSwitches(name, missing):
+			featuresAdded = true
+			if c.debugEnabled {
+				fmt.Printf("🔎 %s requires features %v, retrying\n", name, missing)
+			}
+
+		case isStaleQueryError(err) && !rediscovered && c.rediscover(ctx, op):
+			rediscovered = true
+			if c.debugEnabled {
+				fmt.Printf("🔎 Query ID of %s was rotated, retrying\n", name)
+			}
+
+		default:
+			return body, err
+		}
+	}
+}
+
+// applyFeatureSwitches updates the registry's feature switches from the
+// homepage once per key material snapshot
+func (c *Client) applyFeatureSwitches() {
+	snapshot := c.txnGen.snapshot.Load()
+	if snapshot == nil || c.switchesFrom.Swap(snapshot) == snapshot {
+		return
+	}
+	switches, err := parseFeatureSwitches(snapshot.homePageHTML)
+	if err != nil {
+		if c.debugEnabled {
+			fmt.Printf("⚠️ Using built-in feature switches: %v\n", err)
+		}
+		return
+	}
+	c.operations.SetFeatureSwitches(switches)
+}
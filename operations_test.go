@@ -0,0 +1,141 @@
+package xapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOperationRegistryUpdate(t *testing.T) {
+	r := NewOperationRegistry()
+	op, ok := r.Get("UserByScreenName")
+	if !ok || op.QueryID != "ck5KkZ8t5cOmoLssopN99Q" || len(op.FeatureSwitches) == 0 {
+		t.Fatalf("Expected the default UserByScreenName operation, got %+v", op)
+	}
+
+	// Copies are independent of the registry
+	op.FeatureSwitches[0] = "changed"
+	if fresh, _ := r.Get("UserByScreenName"); fresh.FeatureSwitches[0] == "changed" {
+		t.Error("Modifying a returned operation should not change the registry")
+	}
+	op.Features = map[string]bool{"hidden_profile_subscriptions_enabled": false}
+	r.Set(op)
+
+	bundle := `a={queryId:"NewUserQueryID",operationName:"UserByScreenName",operationType:"query",metadata:{featureSwitches:["hidden_profile_subscriptions_enabled","new_switch"],fieldToggles:["withAuxiliaryUserLabels"]}},` +
+		`b={queryId:"qxWQxcMLiTPcavz9Qy5hwQ",operationName:"TweetResultByRestId",operationType:"query",metadata:{featureSwitches:[],fieldToggles:[]}},` +
+		`c={queryId:"Search-Query_ID",operationName:"SearchTimeline",operationType:"query"}`
+	changed := r.Update(bundle)
+	if want := []string{"UserByScreenName", "SearchTimeline"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("Update changed %v, want %v", changed, want)
+	}
+
+	op, _ = r.Get("UserByScreenName")
+	if op.QueryID != "NewUserQueryID" || len(op.Features) != 1 {
+		t.Errorf("Expected the new query ID with the overrides kept, got %+v", op)
+	}
+	if toggle, ok := op.FieldToggles["withAuxiliaryUserLabels"]; !ok || toggle {
+		t.Errorf("Declared field toggles should be added as false, got %v", op.FieldToggles)
+	}
+	if !reflect.DeepEqual(op.FeatureSwitches, []string{"hidden_profile_subscriptions_enabled", "new_switch"}) {
+		t.Errorf("Unexpected feature switches %v", op.FeatureSwitches)
+	}
+	if op, ok := r.Get("SearchTimeline"); !ok || op.endpoint() != "Search-Query_ID/SearchTimeline" {
+		t.Errorf("Expected a new operation, got %+v", op)
+	}
+
+	params := op.params(map[string]string{"variables": "{}"}, r.Features("UserByScreenName"))
+	if params["features"] != `{"hidden_profile_subscriptions_enabled":false,"new_switch":false}` || params["fieldToggles"] != `{"withAuxiliaryUserLabels":false}` {
+		t.Errorf("Unexpected request parameters %v", params)
+	}
+	if params := op.params(map[string]string{"features": "{}"}, r.Features("UserByScreenName")); params["features"] != "{}" {
+		t.Error("Explicit features should not be replaced")
+	}
+}
+
+func TestStaleQueryIDRediscovery(t *testing.T) {
+	server := newStandIn(t)
+
+	var mu sync.Mutex
+	var paths []string
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if !strings.HasPrefix(r.URL.Path, "/graphql/RotatedQueryID/") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	rotated := DefaultOperations()[0]
+	rotated.QueryID = "RotatedQueryID"
+	server.apiBundle.Store(fixtureBundleJS(rotated))
+
+	client := server.client(t)
+	defer client.Close()
+	if _, err := client.User(context.Background(), "nasa"); err != nil {
+		t.Fatalf("Request with a stale query ID should be retried after discovery: %v", err)
+	}
+	want := []string{"/graphql/ck5KkZ8t5cOmoLssopN99Q/UserByScreenName", "/graphql/RotatedQueryID/UserByScreenName"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Requested %v, want %v", paths, want)
+	}
+	if n := server.bundleFetches.Load(); n != 2 {
+		t.Errorf("Expected the main and api bundles to be fetched once, got %d", n)
+	}
+	if client.Operations().DiscoveredAt().IsZero() {
+		t.Error("Discovery time should be recorded")
+	}
+
+	// The new ID is used from now on
+	if _, err := client.User(context.Background(), "nasa"); err != nil || paths[len(paths)-1] != want[1] {
+		t.Fatalf("Expected the rediscovered query ID, got %v: %v", paths, err)
+	}
+
+	// A 404 that discovery cannot fix is returned after a single attempt, and
+	// discovery is not repeated right away
+	mu.Lock()
+	paths = nil
+	mu.Unlock()
+	_, err := client.Tweet(context.Background(), "20")
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected the 404, got %v", err)
+	}
+	if len(paths) != 1 || server.bundleFetches.Load() != 2 {
+		t.Errorf("Expected one request and no new discovery, got %v and %d bundle fetches", paths, server.bundleFetches.Load())
+	}
+}
+
+func TestDiscoverOperations(t *testing.T) {
+	server := newStandIn(t)
+	config := server.config()
+	config.Operations = NewOperationRegistry()
+	config.Operations.Set(Operation{Name: "Followers", QueryID: "PinnedButStale"})
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+	if client.Operations() != config.Operations {
+		t.Fatal("The configured registry should be used")
+	}
+
+	changed, err := client.DiscoverOperations(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverOperations failed: %v", err)
+	}
+	if !reflect.DeepEqual(changed, []string{"Followers"}) {
+		t.Errorf("Expected only the stale operation to change, got %v", changed)
+	}
+	if op, _ := client.Operations().Get("Followers"); op.QueryID != "i6PPdIMm1MO7CpAqjau7sw" {
+		t.Errorf("Expected the bundle's query ID, got %s", op.QueryID)
+	}
+}
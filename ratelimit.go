@@ -0,0 +1,169 @@
+package xapi
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimitState is the server-reported rate limit budget for one GraphQL operation,
+// parsed from the x-rate-limit-limit, x-rate-limit-remaining and x-rate-limit-reset
+// response headers.
+type RateLimitState struct {
+	Operation string    `json:"operation"`  // Operation name, e.g. "UserByScreenName"
+	Limit     int       `json:"limit"`      // Requests allowed per window
+	Remaining int       `json:"remaining"`  // Requests left in the current window
+	Reset     time.Time `json:"reset"`      // When the current window resets
+	UpdatedAt time.Time `json:"updated_at"` // When the server last reported this state
+}
+
+// Paused reports whether the operation has no budget left before its reset time
+func (s RateLimitState) Paused(now time.Time) bool {
+	return s.Remaining <= 0 && now.Before(s.Reset)
+}
+
+// operationLimiter tracks rate limit windows per GraphQL operation and holds
+// back requests for operations the server has told us are exhausted
+type operationLimiter struct {
+	mu     sync.Mutex
+	states map[string]*RateLimitState
+}
+
+func newOperationLimiter() *operationLimiter {
+	return &operationLimiter{
+		states: make(map[string]*RateLimitState),
+	}
+}
+
+// wait blocks until the operation has budget, reserving one request from it.
+// If the reset is further away than maxWait it fails fast with a *RateLimitError.
+func (l *operationLimiter) wait(ctx context.Context, operation string, maxWait time.Duration) error {
+	for {
+		l.mu.Lock()
+		state, ok := l.states[operation]
+		now := time.Now()
+		if !ok || !now.Before(state.Reset) {
+			l.mu.Unlock()
+			return nil
+		}
+		if state.Remaining > 0 {
+			// Reserve a slot so concurrent callers can't overshoot the window
+			state.Remaining--
+			l.mu.Unlock()
+			return nil
+		}
+		snapshot := *state
+		l.mu.Unlock()
+
+		delay := snapshot.Reset.Sub(now)
+		if delay > maxWait {
+			return &RateLimitError{
+				Operation: operation,
+				Limit:     snapshot.Limit,
+				Remaining: snapshot.Remaining,
+				Reset:     snapshot.Reset,
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// observe records the rate limit headers of a response for an operation
+func (l *operationLimiter) observe(operation string, statusCode int, header http.Header) {
+	limit, limitErr := strconv.Atoi(header.Get("x-rate-limit-limit"))
+	remaining, remainingErr := strconv.Atoi(header.Get("x-rate-limit-remaining"))
+	reset, resetErr := strconv.ParseInt(header.Get("x-rate-limit-reset"), 10, 64)
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.states[operation]
+	if !ok {
+		state = &RateLimitState{Operation: operation}
+	}
+
+	switch {
+	case resetErr == nil:
+		state.Reset = time.Unix(reset, 0)
+		if limitErr == nil {
+			state.Limit = limit
+		}
+		if remainingErr == nil {
+			state.Remaining = remaining
+		}
+
+	case statusCode == http.StatusTooManyRequests:
+		// No window reported - fall back to Retry-After to pause the operation
+		seconds, err := strconv.Atoi(header.Get("Retry-After"))
+		if err != nil {
+			return
+		}
+		state.Reset = now.Add(time.Duration(seconds) * time.Second)
+
+	default:
+		return
+	}
+
+	if statusCode == http.StatusTooManyRequests {
+		state.Remaining = 0
+	}
+	state.UpdatedAt = now
+	l.states[operation] = state
+}
+
+// pausedUntil reports whether an operation is exhausted and when its window resets
+func (l *operationLimiter) pausedUntil(operation string, now time.Time) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state, ok := l.states[operation]
+	if !ok || !state.Paused(now) {
+		return time.Time{}, false
+	}
+	return state.Reset, true
+}
+
+// status returns a copy of every tracked operation's state
+func (l *operationLimiter) status() map[string]RateLimitState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	status := make(map[string]RateLimitState, len(l.states))
+	for operation, state := range l.states {
+		status[operation] = *state
+	}
+	return status
+}
+
+// RateLimitStatus returns the last server-reported rate limit state for every
+// GraphQL operation the client has called, keyed by operation name. With an
+// identity pool it reports the primary identity; IdentityStats has the rest.
+//
+// Example:
+//
+//	for op, state := range client.RateLimitStatus() {
+//	    fmt.Printf("%s: %d/%d, resets %s\n", op, state.Remaining, state.Limit, state.Reset)
+//	}
+func (c *Client) RateLimitStatus() map[string]RateLimitState {
+	return c.identities.primary().limiter.status()
+}
+
+// operationName strips the query ID from a GraphQL endpoint ("<queryID>/<name>"),
+// so rate limit state survives query ID rotation
+func operationName(endpoint string) string {
+	if i := strings.LastIndex(endpoint, "/"); i >= 0 {
+		return endpoint[i+1:]
+	}
+	return endpoint
+}
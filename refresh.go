@@ -0,0 +1,202 @@
+package xapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Background refresh retry bounds when the config leaves them unset
+const (
+	defaultRefreshRetryBase = time.Second
+	maxRefreshRetryDelay    = 5 * time.Minute
+)
+
+// refreshCall is one refresh shared by every caller that triggers it while
+// it is running
+type refreshCall struct {
+	done  chan struct{}
+	err   error
+	force bool
+}
+
+// triggerRefresh starts a refresh in the background, or joins the one already
+// running. With force the key material is replaced even if it is still fresh;
+// otherwise the refresh is skipped when a concurrent one already renewed it.
+//
+// After a failure, triggers without force return nil until the backoff has
+// passed, so requests serving stale material do not hammer the homepage.
+func (tg *TransactionGenerator) triggerRefresh(force bool) *refreshCall {
+	tg.flightMu.Lock()
+	defer tg.flightMu.Unlock()
+
+	if tg.inflight != nil {
+		return tg.inflight
+	}
+	if !force && time.Now().Before(tg.retryAt) {
+		return nil
+	}
+
+	call := &refreshCall{done: make(chan struct{}), force: force}
+	tg.inflight = call
+	go func() {
+		if force {
+			call.err = tg.Refresh(tg.ctx)
+		} else {
+			call.err = tg.refreshIfNeeded(tg.ctx)
+		}
+
+		tg.flightMu.Lock()
+		tg.inflight = nil
+		tg.retryAt = time.Time{}
+		if call.err != nil {
+			tg.retryAt = time.Now().Add(tg.refreshRetryDelay())
+		}
+		tg.flightMu.Unlock()
+
+		close(call.done)
+	}()
+	return call
+}
+
+// refreshAfterFailure renews the key material a failed request was signed
+// with, sharing one refresh between every request that fails at once. It does
+// nothing if the material was replaced since seen, the snapshot the request used.
+//
+// A background refresh that is already running may keep material it considers
+// fresh, so once it ends a forced refresh follows unless it replaced seen.
+func (tg *TransactionGenerator) refreshAfterFailure(ctx context.Context, seen *keySnapshot) error {
+	if tg.staticSources {
+		return nil
+	}
+
+	for tg.snapshot.Load() == seen {
+		call := tg.triggerRefresh(true)
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if call.force {
+			return call.err
+		}
+	}
+	return nil
+}
+
+// recordRefreshResult counts a refresh attempt and keeps the last failure for GetStats
+func (tg *TransactionGenerator) recordRefreshResult(err error) {
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+
+	tg.metrics.RefreshAttempts++
+	if err == nil {
+		tg.lastRefreshErr = nil
+		tg.lastRefreshErrAt = time.Time{}
+		tg.refreshFailures = 0
+		return
+	}
+
+	tg.metrics.RefreshFailures++
+	tg.lastRefreshErr = err
+	tg.lastRefreshErrAt = time.Now()
+	tg.refreshFailures++
+}
+
+// refreshRetryDelay returns the backoff before retrying after the current run
+// of consecutive refresh failures, using the configured retry policy
+func (tg *TransactionGenerator) refreshRetryDelay() time.Duration {
+	tg.mu.RLock()
+	failures := tg.refreshFailures
+	tg.mu.RUnlock()
+
+	base := tg.config.RetryBackoffBase
+	if base <= 0 {
+		base = defaultRefreshRetryBase
+	}
+	multiplier := tg.config.RetryBackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+
+	delay := tg.config.retryPolicy().backoff(base, multiplier, max(failures, 1), 0)
+	if delay > maxRefreshRetryDelay {
+		delay = maxRefreshRetryDelay
+	}
+	return delay
+}
+
+// startRefreshLoop starts the background refresh loop once key material is
+// available, if the config asks for it. Material without a cache lifetime is
+// refreshed inline instead, as there is nothing to renew ahead of.
+func (tg *TransactionGenerator) startRefreshLoop() {
+	if !tg.config.BackgroundRefresh || tg.staticSources ||
+		tg.config.HTMLDataCacheLifetime <= 0 || tg.config.AnimationKeyLifetime <= 0 {
+		return
+	}
+	tg.loopOnce.Do(func() {
+		go tg.refreshLoop()
+	})
+}
+
+// refreshLoop renews the key material RefreshAhead before it expires and
+// retries failed refreshes with backoff until the generator is closed
+func (tg *TransactionGenerator) refreshLoop() {
+	timer := time.NewTimer(tg.scheduleRefresh())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-tg.ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		call := tg.triggerRefresh(true)
+		select {
+		case <-tg.ctx.Done():
+			return
+		case <-call.done:
+		}
+
+		if call.err != nil && tg.config.EnableDebugLogging {
+			fmt.Printf("⚠️ Background key material refresh failed: %v\n", call.err)
+		}
+		timer.Reset(tg.scheduleRefresh())
+	}
+}
+
+// scheduleRefresh records and returns the delay until the next background
+// refresh: the pending retry after a failure, otherwise RefreshAhead before
+// the earliest cache expiry. A refresh is never scheduled in the first half
+// of the material's lifetime, so a large RefreshAhead cannot cause a busy loop.
+//
+// Expiry is measured with the configured clock, while retries and the timer
+// run on wall time, so a fixed or skewed Clock cannot stretch or skip the backoff.
+func (tg *TransactionGenerator) scheduleRefresh() time.Duration {
+	now := tg.config.clock().Now()
+
+	snapshot := tg.snapshot.Load()
+	fetched := snapshot.fetchedAt
+	expires := snapshot.htmlDataCache.ExpiresAt
+	if snapshot.animationCache.ExpiresAt.Before(expires) {
+		expires = snapshot.animationCache.ExpiresAt
+	}
+
+	at := expires.Add(-tg.config.RefreshAhead)
+	if halfway := fetched.Add(expires.Sub(fetched) / 2); at.Before(halfway) {
+		at = halfway
+	}
+
+	delay := at.Sub(now)
+
+	tg.flightMu.Lock()
+	defer tg.flightMu.Unlock()
+	if !tg.retryAt.IsZero() {
+		delay = time.Until(tg.retryAt)
+	}
+	delay = max(delay, 0)
+	tg.nextRefresh = now.Add(delay)
+
+	return delay
+}
@@ -0,0 +1,311 @@
+package xapi
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually polls cond until it holds or the deadline passes
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBackgroundRefreshServesStale(t *testing.T) {
+	server := newStandIn(t)
+	config := server.config()
+
+	tg, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	// Expire the material and hold the refresh at the homepage
+	tg.refreshMutex.Lock()
+	tg.expire()
+	tg.refreshMutex.Unlock()
+	gate := make(chan struct{})
+	server.homeGate.Store(gate)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := tg.Generate("GET", "/graphql/test")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Stale generator should keep serving: %v", err)
+		}
+	}
+
+	eventually(t, "the background refresh", func() bool { return server.homeFetches.Load() == 2 })
+	if !tg.IsStale() {
+		t.Error("Material should stay stale until the refresh completes")
+	}
+
+	close(gate)
+	eventually(t, "fresh material", func() bool { return !tg.IsStale() })
+	if server.homeFetches.Load() != 2 {
+		t.Errorf("Concurrent stale requests should share one refresh, got %d fetches", server.homeFetches.Load())
+	}
+}
+
+func TestBackgroundRefreshAhead(t *testing.T) {
+	server := newStandIn(t)
+	config := server.config()
+	config.HTMLDataCacheLifetime = 400 * time.Millisecond
+	config.AnimationKeyLifetime = 400 * time.Millisecond
+	config.RefreshAhead = 300 * time.Millisecond
+
+	tg, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	// Half the lifetime passes before the first refresh, however large RefreshAhead is
+	eventually(t, "the refresh schedule", func() bool { return !tg.GetStats().NextRefresh.IsZero() })
+	stats := tg.GetStats()
+	if lead := stats.NextRefresh.Sub(stats.LastFetchTime); lead != 200*time.Millisecond {
+		t.Errorf("Expected the refresh halfway through the lifetime, got %v after the fetch", lead)
+	}
+	eventually(t, "a refresh ahead of expiry", func() bool { return server.homeFetches.Load() >= 2 })
+
+	// Failures are retried with backoff and surfaced in the stats
+	server.homeDown.Store(true)
+	eventually(t, "repeated refresh failures", func() bool { return tg.GetStats().ConsecutiveRefreshFailures >= 2 })
+	stats = tg.GetStats()
+	if stats.LastRefreshError == "" || stats.LastRefreshErrorTime.IsZero() {
+		t.Errorf("Expected the last refresh error in the stats, got %+v", stats)
+	}
+	if _, err := tg.Generate("GET", "/graphql/test"); err != nil {
+		t.Errorf("Generator should serve stale material while refreshes fail: %v", err)
+	}
+
+	server.homeDown.Store(false)
+	eventually(t, "a successful retry", func() bool { return tg.GetStats().LastRefreshError == "" })
+	if tg.GetStats().ConsecutiveRefreshFailures != 0 {
+		t.Error("A successful refresh should reset the failure count")
+	}
+
+	// Close stops the loop
+	tg.Close()
+	time.Sleep(50 * time.Millisecond)
+	fetches := server.homeFetches.Load()
+	time.Sleep(500 * time.Millisecond)
+	if server.homeFetches.Load() != fetches {
+		t.Error("Closed generator should stop refreshing")
+	}
+}
+
+func TestGenerateDuringRefresh(t *testing.T) {
+	server := newStandIn(t)
+	tg, err := NewTransactionGeneratorWithConfig(server.config())
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	// Generate reads a published snapshot while refreshes build the next one
+	stop := make(chan struct{})
+	refreshed := make(chan error, 1)
+	go func() {
+		defer close(refreshed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := tg.ForceRefresh(); err != nil {
+				refreshed <- err
+				return
+			}
+			tg.GetStats()
+			tg.GetMetrics()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if _, err := tg.Generate("GET", "/graphql/test"); err != nil {
+					t.Errorf("Generate failed during refresh: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	if err := <-refreshed; err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+
+	metrics := tg.GetMetrics()
+	if metrics.TotalGenerations != 8*200 {
+		t.Errorf("Expected %d generations, got %d", 8*200, metrics.TotalGenerations)
+	}
+	if metrics.RefreshAttempts == 0 || metrics.HTMLDataFetches != metrics.RefreshAttempts+1 {
+		t.Errorf("Every refresh should fetch once: %+v", metrics)
+	}
+}
+
+func TestAuthErrorsShareOneRefresh(t *testing.T) {
+	server := newStandIn(t)
+
+	// Every request is rejected, the first ones only once all have been sent
+	const concurrent = 10
+	var arrived sync.WaitGroup
+	arrived.Add(concurrent)
+	released := make(chan struct{})
+	var first atomic.Int32
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		if first.Add(1) <= concurrent {
+			arrived.Done()
+			<-released
+		}
+		http.Error(w, `denied`, http.StatusForbidden)
+	})
+	go func() {
+		arrived.Wait()
+		close(released)
+	}()
+
+	config := server.config()
+	config.CircuitBreaker = &CircuitBreakerConfig{}
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.User(context.Background(), "nasa"); err == nil {
+				t.Error("Expected the auth error")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := server.homeFetches.Load(); n != 2 {
+		t.Errorf("Requests failing with the same key material should share one refresh, got %d homepage fetches", n)
+	}
+	if stats := client.txnGen.GetMetrics(); stats.RefreshAttempts != 1 {
+		t.Errorf("Expected one refresh attempt, got %d", stats.RefreshAttempts)
+	}
+}
+
+func TestKeyMaterialExpiryUsesClock(t *testing.T) {
+	server := newStandIn(t)
+	config := server.config()
+	var now atomic.Int64
+	now.Store(1700000000)
+	config.Clock = ClockFunc(func() time.Time { return time.Unix(now.Load(), 0) })
+
+	tg, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	if tg.IsStale() || !tg.GetMetrics().LastRefreshTime.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("Material should be fetched at the configured time: %+v", tg.GetMetrics())
+	}
+	now.Add(int64(config.HTMLDataCacheLifetime/time.Second) + 1)
+	if !tg.IsStale() {
+		t.Error("Material should expire by the configured clock")
+	}
+
+	if err := tg.ForceRefresh(); err != nil {
+		t.Fatalf("ForceRefresh failed: %v", err)
+	}
+	tg.refreshMutex.Lock()
+	tg.expire()
+	tg.refreshMutex.Unlock()
+	if !tg.IsStale() || !tg.snapshot.Load().htmlDataCache.ExpiresAt.Before(time.Unix(now.Load(), 0)) {
+		t.Error("Expired material should be stale by the configured clock")
+	}
+}
+
+func TestBackgroundRetryWithFixedClock(t *testing.T) {
+	// A clock far behind or ahead of wall time must not stall or spin the retries
+	for name, offset := range map[string]time.Duration{"behind": -365 * 24 * time.Hour, "ahead": 365 * 24 * time.Hour} {
+		t.Run(name, func(t *testing.T) {
+			server := newStandIn(t)
+			config := server.config()
+			fixed := time.Now().Add(offset)
+			config.Clock = ClockFunc(func() time.Time { return fixed })
+			config.HTMLDataCacheLifetime = 200 * time.Millisecond
+			config.AnimationKeyLifetime = 200 * time.Millisecond
+			config.RetryBackoffBase = 50 * time.Millisecond
+			config.RetryBackoffMultiplier = 2
+
+			tg, err := NewTransactionGeneratorWithConfig(config)
+			if err != nil {
+				t.Fatalf("Failed to create generator: %v", err)
+			}
+			defer tg.Close()
+
+			server.homeDown.Store(true)
+			eventually(t, "retried refresh failures", func() bool { return tg.GetStats().ConsecutiveRefreshFailures >= 2 })
+			time.Sleep(300 * time.Millisecond)
+			if n := server.homeFetches.Load(); n > 10 {
+				t.Errorf("Failed refreshes should back off, got %d homepage fetches", n)
+			}
+		})
+	}
+}
+
+func TestAuthErrorForcesRefreshAfterBackgroundCheck(t *testing.T) {
+	server := newStandIn(t)
+	tg, err := NewTransactionGeneratorWithConfig(server.config())
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	// A background check is running and will find the material still fresh
+	tg.refreshMutex.Lock()
+	if tg.triggerRefresh(false) == nil {
+		tg.refreshMutex.Unlock()
+		t.Fatal("Expected a background refresh to start")
+	}
+
+	seen := tg.snapshot.Load()
+	done := make(chan error, 1)
+	go func() { done <- tg.refreshAfterFailure(context.Background(), seen) }()
+	time.Sleep(20 * time.Millisecond)
+	tg.refreshMutex.Unlock()
+
+	if err := <-done; err != nil {
+		t.Fatalf("Refresh after failure failed: %v", err)
+	}
+	if tg.snapshot.Load() == seen || server.homeFetches.Load() != 2 {
+		t.Errorf("Rejected material should be replaced, got %d homepage fetches", server.homeFetches.Load())
+	}
+}
@@ -0,0 +1,315 @@
+package xapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorClass groups request failures by how they should be retried
+type ErrorClass int
+
+const (
+	ErrorClassUnknown     ErrorClass = iota // Unclassified failures such as malformed responses
+	ErrorClassNetwork                       // Connection, DNS and timeout errors
+	ErrorClassServer                        // 5xx responses
+	ErrorClassRateLimit                     // 429 responses and paused operations
+	ErrorClassAuth                          // 401/403 responses
+	ErrorClassNotFound                      // User, tweet or broadcast does not exist
+	ErrorClassValidation                    // GraphQL validation errors (bad variables or features)
+	ErrorClassClient                        // Other 4xx responses
+	ErrorClassCanceled                      // Context cancelled or deadline exceeded
+	ErrorClassCircuitOpen                   // Rejected by an open circuit breaker
+)
+
+// String returns the class name used in debug logs
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorClassNetwork:
+		return "network"
+	case ErrorClassServer:
+		return "server"
+	case ErrorClassRateLimit:
+		return "rate_limit"
+	case ErrorClassAuth:
+		return "auth"
+	case ErrorClassNotFound:
+		return "not_found"
+	case ErrorClassValidation:
+		return "validation"
+	case ErrorClassClient:
+		return "client"
+	case ErrorClassCanceled:
+		return "canceled"
+	case ErrorClassCircuitOpen:
+		return "circuit_open"
+	default:
+		return "unknown"
+	}
+}
+
+// JitterMode selects how retry delays are randomized
+type JitterMode int
+
+const (
+	JitterNone         JitterMode = iota // Plain exponential backoff
+	JitterFull                           // Uniform in [0, exponential delay]
+	JitterDecorrelated                   // Uniform in [base, 3 * previous delay]
+)
+
+// RetryRule controls retries for one error class
+type RetryRule struct {
+	Retry       bool // Whether errors of this class are retried at all
+	MaxAttempts int  // Retries allowed for this class, 0 means MaxRetryAttempts
+}
+
+// RetryPolicy decides which failures are retried and how long to wait between attempts.
+//
+// The base delay and multiplier come from ProductionConfig.RetryBackoffBase and
+// RetryBackoffMultiplier; the policy adds classification, jitter, Retry-After
+// handling and a cap on total retry time per call.
+type RetryPolicy struct {
+	Rules           map[ErrorClass]RetryRule // Per-class rules, missing classes are not retried
+	Jitter          JitterMode               // Delay randomization
+	MaxDelay        time.Duration            // Upper bound for a single delay (0 = unbounded)
+	MaxElapsed      time.Duration            // Total time budget for retries per call (0 = unbounded)
+	HonorRetryAfter bool                     // Wait at least Retry-After / until x-rate-limit-reset
+	Classify        func(error) ErrorClass   // Optional override for ClassifyError
+}
+
+// DefaultRetryPolicy returns a policy that retries transient failures with full jitter,
+// retries auth errors once after refreshing the transaction ID, and never retries
+// not-found, validation or unclassified errors such as malformed responses.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Rules: map[ErrorClass]RetryRule{
+			ErrorClassNetwork:   {Retry: true},
+			ErrorClassServer:    {Retry: true},
+			ErrorClassRateLimit: {Retry: true},
+			ErrorClassAuth:      {Retry: true, MaxAttempts: 1},
+		},
+		Jitter:          JitterFull,
+		MaxDelay:        30 * time.Second,
+		MaxElapsed:      2 * time.Minute,
+		HonorRetryAfter: true,
+	}
+}
+
+// ClassifyError maps an error returned by the client to its ErrorClass
+func ClassifyError(err error) ErrorClass {
+	var rateErr *RateLimitError
+	var authErr *AuthError
+	var gqlErr *GraphQLError
+	var httpErr *HTTPError
+	var netErr net.Error
+
+	switch {
+	case err == nil:
+		return ErrorClassUnknown
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassCanceled
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorClassCircuitOpen
+	case errors.Is(err, ErrNotFound):
+		return ErrorClassNotFound
+	case errors.As(err, &rateErr):
+		return ErrorClassRateLimit
+	case errors.As(err, &authErr):
+		return ErrorClassAuth
+	case errors.As(err, &gqlErr):
+		for _, apiErr := range gqlErr.Errors {
+			if apiErr.Kind == "Validation" {
+				return ErrorClassValidation
+			}
+		}
+		return ErrorClassUnknown
+	case errors.As(err, &httpErr):
+		if httpErr.StatusCode >= 500 {
+			return ErrorClassServer
+		}
+		return ErrorClassClient
+	case errors.As(err, &netErr):
+		return ErrorClassNetwork
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// classify applies the policy's classifier override, if any
+func (p *RetryPolicy) classify(err error) ErrorClass {
+	if p.Classify != nil {
+		return p.Classify(err)
+	}
+	return ClassifyError(err)
+}
+
+// allows reports whether another retry is permitted for the class
+func (p *RetryPolicy) allows(class ErrorClass, classRetries int) bool {
+	rule, ok := p.Rules[class]
+	if !ok || !rule.Retry || class == ErrorClassCanceled {
+		return false
+	}
+	return rule.MaxAttempts == 0 || classRetries < rule.MaxAttempts
+}
+
+// backoff returns the delay before retry number attempt (1-based)
+func (p *RetryPolicy) backoff(base time.Duration, multiplier float64, attempt int, previous time.Duration) time.Duration {
+	exponential := float64(base) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 {
+		exponential = math.Min(exponential, float64(p.MaxDelay))
+	}
+
+	var delay time.Duration
+	switch p.Jitter {
+	case JitterFull:
+		delay = time.Duration(rand.Float64() * exponential)
+	case JitterDecorrelated:
+		if previous < base {
+			previous = base
+		}
+		upper := float64(previous) * 3
+		delay = time.Duration(float64(base) + rand.Float64()*(upper-float64(base)))
+	default:
+		delay = time.Duration(exponential)
+	}
+
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// retryAfter returns the server-requested wait carried by an error, if any
+func retryAfter(err error) time.Duration {
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		if rateErr.RetryAfter > 0 {
+			return rateErr.RetryAfter
+		}
+		if !rateErr.Reset.IsZero() {
+			return time.Until(rateErr.Reset)
+		}
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.Header != nil {
+		value := httpErr.Header.Get("Retry-After")
+		if seconds, err := strconv.Atoi(value); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return time.Until(at)
+		}
+	}
+	return 0
+}
+
+// executeWithRetry runs an endpoint operation under the configured RetryPolicy.
+// It is shared by every endpoint regardless of result type.
+func executeWithRetry[T any](ctx context.Context, c *Client, operation func(context.Context) (T, error)) (T, error) {
+	var zero T
+
+	requestID := c.recordRequest()
+
+	start := time.Now()
+	defer func() {
+		c.updateLatencyMetrics(time.Since(start))
+	}()
+
+	policy := c.config.retryPolicy()
+	maxRetries := 0
+	if c.retryEnabled {
+		maxRetries = c.config.MaxRetryAttempts
+	}
+
+	var lastError error
+	var delay time.Duration
+	classRetries := make(map[ErrorClass]int)
+	attempt := 0
+
+	for {
+		attempt++
+		if attempt > 1 {
+			c.recordRetry()
+		}
+
+		if c.debugEnabled {
+			fmt.Printf("🔄 Request #%d, attempt %d/%d\n", requestID, attempt, maxRetries+1)
+		}
+
+		// Execute the operation, noting the key material it is signed with
+		snapshot := c.txnGen.snapshot.Load()
+		result, err := operation(ctx)
+
+		if err == nil {
+			// Success - update metrics and reset error streak
+			c.recordSuccess()
+			if c.debugEnabled && attempt > 1 {
+				fmt.Printf("✅ Request #%d succeeded after %d attempts\n", requestID, attempt)
+			}
+			return result, nil
+		}
+
+		// Record the error
+		lastError = err
+		c.recordError()
+
+		// Terminal errors, exhausted budgets and cancelled contexts stop here
+		class := policy.classify(err)
+		if ctx.Err() != nil || attempt > maxRetries || !policy.allows(class, classRetries[class]) {
+			break
+		}
+		classRetries[class]++
+
+		delay = policy.backoff(c.config.RetryBackoffBase, c.config.RetryBackoffMultiplier, attempt, delay)
+		if policy.HonorRetryAfter {
+			if wait := retryAfter(err); wait > delay {
+				delay = wait
+			}
+		}
+
+		// Give up rather than sleep past the per-call retry budget
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			if c.debugEnabled {
+				fmt.Printf("⏱️ Request #%d retry budget of %v exhausted\n", requestID, policy.MaxElapsed)
+			}
+			break
+		}
+
+		if c.debugEnabled {
+			fmt.Printf("⚠️ Request #%d failed (attempt %d, %s): %v, retrying in %v...\n",
+				requestID, attempt, class, err, delay)
+		}
+
+		// Wait before retry (with context cancellation support)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			// Auth failures usually mean stale key material; otherwise refresh on error streaks
+			if class == ErrorClassAuth || c.shouldRefreshDueToErrors() {
+				if c.debugEnabled {
+					fmt.Printf("🔄 Refreshing data due to %s error (streak %d)\n", class, c.getErrorStreak())
+				}
+				if err := c.txnGen.refreshAfterFailure(ctx, snapshot); err != nil && c.debugEnabled {
+					fmt.Printf("⚠️ Request #%d key material refresh failed: %v\n", requestID, err)
+				}
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return zero, ctx.Err()
+		}
+	}
+
+	// All attempts failed
+	if c.debugEnabled {
+		fmt.Printf("❌ Request #%d failed after %d attempts: %v\n", requestID, attempt, lastError)
+	}
+
+	return zero, fmt.Errorf("request failed after %d attempts: %w", attempt, lastError)
+}
@@ -0,0 +1,140 @@
+package xapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// API error codes that mean the x-csrf-token header did not match the ct0 cookie
+var csrfErrorCodes = map[int]bool{
+	353: true, // This request requires a matching csrf cookie and header
+}
+
+// Session holds the cookies of a logged-in account.
+//
+// With a session the client authenticates as that account instead of as a guest,
+// which unlocks endpoints that require login. AuthToken and CSRFToken can be
+// copied from a browser's auth_token and ct0 cookies, or obtained with Login.
+//
+// Example:
+//
+//	config := xapi.DefaultProductionConfig()
+//	config.Session = &xapi.Session{
+//	    AuthToken: os.Getenv("X_AUTH_TOKEN"),
+//	    CSRFToken: os.Getenv("X_CT0"),
+//	}
+//	client, err := xapi.NewClient(config)
+type Session struct {
+	AuthToken string `json:"auth_token"`     // auth_token cookie
+	CSRFToken string `json:"ct0"`            // ct0 cookie, echoed as x-csrf-token
+	TwID      string `json:"twid,omitempty"` // twid cookie, e.g. "u=44196397" (optional)
+
+	// Browser the session presents as (optional). Login sets the profile the
+	// account logged in with, so later requests look like the same browser.
+	Profile *BrowserProfile `json:"profile,omitempty"`
+}
+
+// Validate checks that the required cookies are present
+func (s *Session) Validate() error {
+	if s.AuthToken == "" {
+		return fmt.Errorf("session: auth_token is required")
+	}
+	if s.CSRFToken == "" {
+		return fmt.Errorf("session: ct0 is required")
+	}
+	if s.Profile != nil && s.Profile.UserAgent == "" {
+		return fmt.Errorf("session: browser profile has no user agent")
+	}
+	return nil
+}
+
+// UserID returns the account ID encoded in the twid cookie, or "" if unknown
+func (s *Session) UserID() string {
+	twid, err := url.QueryUnescape(s.TwID)
+	if err != nil {
+		twid = s.TwID
+	}
+	return strings.TrimPrefix(strings.Trim(twid, `"`), "u=")
+}
+
+// identity returns the name used to key per-identity state for this session
+func (s *Session) identity() string {
+	if id := s.UserID(); id != "" {
+		return "user:" + id
+	}
+	return "session"
+}
+
+// apply sets the session cookies and headers on a request
+func (s *Session) apply(req *http.Request) {
+	req.Header.Set("X-Csrf-Token", s.CSRFToken)
+	req.Header.Set("X-Twitter-Auth-Type", "OAuth2Session")
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: s.AuthToken})
+	req.AddCookie(&http.Cookie{Name: "ct0", Value: s.CSRFToken})
+	if s.TwID != "" {
+		req.AddCookie(&http.Cookie{Name: "twid", Value: s.TwID})
+	}
+}
+
+// SetSession switches the client's primary identity to an authenticated
+// session, or back to guest mode when session is nil. The session is copied;
+// use Session to read back rotated tokens.
+func (c *Client) SetSession(session *Session) error {
+	if session != nil {
+		if err := session.Validate(); err != nil {
+			return err
+		}
+		copied := *session
+		session = &copied
+	}
+
+	id := c.identities.primary()
+	id.sessionMu.Lock()
+	id.session = session
+	id.sessionMu.Unlock()
+	return nil
+}
+
+// Session returns a copy of the primary identity's session, including any ct0
+// rotation issued by the server, or nil in guest mode
+func (c *Client) Session() *Session {
+	return c.identities.primary().currentSession()
+}
+
+// rotateCSRFToken adopts a new ct0 cookie issued by the server for an
+// identity's session. It reports whether the token changed.
+func (c *Client) rotateCSRFToken(id *pooledIdentity, resp *http.Response) bool {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name != "ct0" || cookie.Value == "" {
+			continue
+		}
+
+		id.sessionMu.Lock()
+		rotated := id.session != nil && id.session.CSRFToken != cookie.Value
+		if rotated {
+			id.session.CSRFToken = cookie.Value
+		}
+		id.sessionMu.Unlock()
+
+		if rotated && c.debugEnabled {
+			fmt.Printf("🔑 Rotated ct0 CSRF token\n")
+		}
+		return rotated
+	}
+	return false
+}
+
+// isCSRFError reports whether the server rejected the x-csrf-token header
+func isCSRFError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, apiErr := range apiErrorsOf(err) {
+		if csrfErrorCodes[apiErr.Code] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package xapi
+
+import "context"
+
+// NewTransactionGeneratorFromSources creates a transaction generator from
+// homepage HTML and ondemand.s JavaScript fetched by the caller, for example
+// through separate scraping infrastructure or from fixtures.
+//
+// No network access is made, now or later: the key material never expires on
+// its own and is only replaced through UpdateSources. If extraction fails the
+// error is an *ExtractionError naming the failed step.
+//
+// Example:
+//
+//	tg, err := xapi.NewTransactionGeneratorFromSources(homeHTML, onDemandJS)
+//	var extractErr *xapi.ExtractionError
+//	if errors.As(err, &extractErr) {
+//	    log.Printf("source changed shape at %s: %v", extractErr.Step, extractErr.Err)
+//	}
+//	txnID, err := tg.Generate("GET", "/i/api/graphql/abc/UserByScreenName")
+func NewTransactionGeneratorFromSources(homeHTML, onDemandJS string) (*TransactionGenerator, error) {
+	return NewTransactionGeneratorFromSourcesWithConfig(DefaultProductionConfig(), homeHTML, onDemandJS)
+}
+
+// NewTransactionGeneratorFromSourcesWithConfig is NewTransactionGeneratorFromSources
+// with a custom config, for example to choose the Extractors, Clock or Random
+// source. Settings for fetching and refreshing are ignored.
+//
+// Example:
+//
+//	config := xapi.DefaultProductionConfig()
+//	config.Extractors = []xapi.Extractor{xapi.TokenizerExtractor{}, xapi.DOMExtractor{}}
+//	tg, err := xapi.NewTransactionGeneratorFromSourcesWithConfig(config, homeHTML, onDemandJS)
+func NewTransactionGeneratorFromSourcesWithConfig(config *ProductionConfig, homeHTML, onDemandJS string) (*TransactionGenerator, error) {
+	if config == nil {
+		config = DefaultProductionConfig()
+	}
+	lifetime, cancel := context.WithCancel(context.Background())
+	generator := &TransactionGenerator{
+		config:        config,
+		metrics:       &GeneratorMetrics{},
+		ctx:           lifetime,
+		cancel:        cancel,
+		staticSources: true,
+	}
+
+	if err := generator.UpdateSources(homeHTML, onDemandJS); err != nil {
+		cancel()
+		return nil, err
+	}
+	return generator, nil
+}
+
+// UpdateSources hot-swaps the key material with material derived from new
+// homepage HTML and ondemand.s JavaScript. The swap is atomic: if any
+// extraction step fails, an *ExtractionError is returned and the generator
+// keeps its current key material.
+func (tg *TransactionGenerator) UpdateSources(homeHTML, onDemandJS string) error {
+	// Extract into a new snapshot so a failure leaves the live material untouched
+	snapshot, err := newKeySnapshot(homeHTML, onDemandJS, tg.config.extractors())
+	if err != nil {
+		return err
+	}
+
+	tg.refreshMutex.Lock()
+	defer tg.refreshMutex.Unlock()
+
+	now := tg.config.clock().Now()
+	tg.publish(snapshot.withExpiry(now, now.Add(tg.config.HTMLDataCacheLifetime), now.Add(tg.config.AnimationKeyLifetime)))
+	return nil
+}
@@ -0,0 +1,55 @@
+package xapi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTransactionGeneratorFromSources(t *testing.T) {
+	tg, err := NewTransactionGeneratorFromSources(fixtureHomeHTML(), fixtureOnDemandJS())
+	if err != nil {
+		t.Fatalf("Failed to create generator from sources: %v", err)
+	}
+	defer tg.Close()
+
+	stats := tg.GetStats()
+	if stats.KeyLength != len(fixtureKeyBytes) || stats.AnimationKey == "" || stats.IsStale {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if _, err := tg.Generate("GET", "/graphql/test"); err != nil {
+		t.Errorf("Generate failed: %v", err)
+	}
+	if err := tg.ForceRefresh(); err == nil {
+		t.Error("Generator built from sources should refuse network refreshes")
+	}
+
+	// A failed swap names the step and keeps the current material
+	cases := []struct {
+		name       string
+		homeHTML   string
+		onDemandJS string
+		step       ExtractionStep
+	}{
+		{"no indices", fixtureHomeHTML(), "console.log('changed')", StepExtractIndices},
+		{"no key", strings.Replace(fixtureHomeHTML(), "twitter-site-verification", "renamed", 1), fixtureOnDemandJS(), StepExtractKey},
+		{"no frames", strings.ReplaceAll(fixtureHomeHTML(), "loading-x-anim", "renamed"), fixtureOnDemandJS(), StepGenerateAnimationKey},
+	}
+	for _, tc := range cases {
+		err := tg.UpdateSources(tc.homeHTML, tc.onDemandJS)
+		var extractErr *ExtractionError
+		if !errors.As(err, &extractErr) || extractErr.Step != tc.step {
+			t.Errorf("%s: expected failure at %s, got %v", tc.name, tc.step, err)
+		}
+		if tg.GetStats().AnimationKey != stats.AnimationKey {
+			t.Errorf("%s: failed update should keep the current key material", tc.name)
+		}
+	}
+
+	if _, err := NewTransactionGeneratorFromSources("", ""); err == nil {
+		t.Error("Empty sources should fail")
+	}
+	if err := tg.UpdateSources(fixtureHomeHTML(), fixtureOnDemandJS()); err != nil {
+		t.Errorf("Valid update failed: %v", err)
+	}
+}
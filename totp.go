@@ -0,0 +1,68 @@
+package xapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TOTP parameters used by X two-factor authentication (RFC 6238 defaults)
+const (
+	TOTPPeriod = 30 // Seconds per time step
+	TOTPDigits = 6  // Digits per code
+)
+
+// GenerateTOTP returns the RFC 6238 time-based one-time password for a base32
+// secret at time t, as shown by authenticator apps for X two-factor login.
+//
+// The secret may contain spaces, lowercase letters and omit padding.
+//
+// Example:
+//
+//	code, err := xapi.GenerateTOTP("JBSWY3DPEHPK3PXP", time.Now())
+func GenerateTOTP(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return hotp(key, uint64(t.Unix()/TOTPPeriod), TOTPDigits), nil
+}
+
+// decodeTOTPSecret normalizes and decodes a base32 TOTP secret
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	normalized := strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	normalized = strings.TrimRight(normalized, "=")
+	if normalized == "" {
+		return nil, fmt.Errorf("totp: empty secret")
+	}
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("totp: invalid base32 secret: %w", err)
+	}
+	return key, nil
+}
+
+// hotp implements RFC 4226 HMAC-SHA1 one-time passwords
+func hotp(key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < digits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%modulo)
+}
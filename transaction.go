@@ -1,17 +1,17 @@
 package xapi
 
 import (
-	"crypto/rand"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/html"
@@ -24,34 +24,138 @@ const (
 	TwitterEpoch           = 1682924400 // Unix timestamp base
 )
 
+// animationRowLength is the frame row length animate expects; shorter rows are zero padded
+const animationRowLength = 15
+
 // TransactionGenerator is the unified, production-ready transaction ID generator
 // with intelligent caching, automatic refresh, and robust error handling
 type TransactionGenerator struct {
 	config *ProductionConfig
 	
-	// Cache layers with different lifetimes
-	htmlDataCache    *CacheEntry   // HTML data with 6-hour lifetime
-	animationCache   *CacheEntry   // Animation keys with 3-hour lifetime
-	verificationCache *CacheEntry  // Verification keys with 6-hour lifetime
-	
-	// Core data (real algorithm implementation)
-	homePageHTML     string        // Cached HTML from Twitter homepage
-	onDemandFileHTML string        // Cached ondemand.s file content
-	keyBytes         []int         // Decoded verification key bytes
-	animationKey     string        // Generated animation key
-	rowIndex         int           // Dynamic row index from ondemand file
-	keyBytesIndices  []int         // Dynamic indices from ondemand file
-	key              string        // Raw verification key
+	// Current key material, nil until the first fetch. Generate reads it
+	// without locking; refreshes publish a new snapshot.
+	snapshot     atomic.Pointer[keySnapshot]
 	
 	// Thread safety
-	mu           sync.RWMutex
+	mu           sync.RWMutex // Guards metrics and the refresh failure state
 	refreshMutex sync.Mutex  // Separate mutex for refresh operations
 	
+	// Lifetime - Close cancels in-flight and future refreshes
+	ctx          context.Context
+	cancel       context.CancelFunc
+	
+	// Background refresh (see refresh.go)
+	loopOnce     sync.Once
+	flightMu     sync.Mutex
+	inflight     *refreshCall // Refresh shared by every concurrent trigger
+	retryAt      time.Time    // Earliest retry after a failed refresh
+	nextRefresh  time.Time    // When the background loop refreshes next
+	
+	// Last refresh failure, cleared by the next success
+	lastRefreshErr   error
+	lastRefreshErrAt time.Time
+	refreshFailures  int // Consecutive failed refreshes
+	
+	// Diagnostics history (see diagnostics.go), guarded by mu
+	factHistory      []keyFacts
+	keyChanges       []AnimationKeyChange
+	
 	// Production features
 	metrics      *GeneratorMetrics
-	initialized  bool
-	lastRefresh  time.Time
-	httpClient   *http.Client
+	generations  atomic.Int64  // Hot path counters, kept outside mu
+	avgGenTime   atomic.Uint64 // math.Float64bits of the average generation time in ms
+	staticSources bool // Built from supplied sources; never fetches
+	fetchAs      fetchTransport
+}
+
+// fetchTransport returns the HTTP client and browser profile the homepage and
+// ondemand.s downloads are sent with
+type fetchTransport func() (*http.Client, *BrowserProfile)
+
+// keySnapshot is one immutable generation of key material (real algorithm
+// implementation) with its cache layers. It is built off to the side by a
+// fetch, warm start or UpdateSources and then published whole; a published
+// snapshot is never modified.
+type keySnapshot struct {
+	// Cache layers with different lifetimes
+	htmlDataCache     *CacheEntry // HTML data with 6-hour lifetime
+	animationCache    *CacheEntry // Animation keys with 3-hour lifetime
+	verificationCache *CacheEntry // Verification keys with 6-hour lifetime
+	
+	homePageHTML     string // Cached HTML from Twitter homepage
+	onDemandFileHTML string // Cached ondemand.s file content
+	keyBytes         []int  // Decoded verification key bytes
+	animationKey     string // Generated animation key
+	rowIndex         int    // Dynamic row index from ondemand file
+	keyBytesIndices  []int  // Dynamic indices from ondemand file
+	key              string // Raw verification key
+	fetchedAt        time.Time
+	report           ExtractionReport // Which extractor produced the indices and frames
+	onDemandHash     string // ondemand.s chunk hash referenced by the homepage
+	
+	// Frame row fed to animate, unknown (zero) for persisted key material
+	frameIndex       int
+	frameRow         int
+	frameRowLength   int
+	frameRowFallback bool
+}
+
+// newKeySnapshot derives key material from homepage HTML and ondemand.s
+// JavaScript with the given extractor chain. The cache layers are set by withExpiry.
+func newKeySnapshot(homeHTML, onDemandJS string, extractors []Extractor) (*keySnapshot, error) {
+	snapshot := &keySnapshot{
+		homePageHTML:     homeHTML,
+		onDemandFileHTML: onDemandJS,
+		onDemandHash:     onDemandHash(homeHTML),
+	}
+	if err := snapshot.extractAlgorithmData(extractors); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// withExpiry returns a copy of the snapshot with cache layers for the given
+// fetch time and expiry. The key material itself is shared, as it is never modified.
+func (s *keySnapshot) withExpiry(fetchedAt, htmlExpiresAt, animationExpiresAt time.Time) *keySnapshot {
+	copied := *s
+	copied.fetchedAt = fetchedAt
+	copied.htmlDataCache = &CacheEntry{
+		Data:      map[string]string{"homepage": s.homePageHTML, "ondemand": s.onDemandFileHTML},
+		CreatedAt: fetchedAt,
+		ExpiresAt: htmlExpiresAt,
+	}
+	copied.animationCache = &CacheEntry{
+		Data:      s.animationKey,
+		CreatedAt: fetchedAt,
+		ExpiresAt: animationExpiresAt,
+	}
+	copied.verificationCache = &CacheEntry{
+		Data:      s.key,
+		CreatedAt: fetchedAt,
+		ExpiresAt: htmlExpiresAt,
+	}
+	return &copied
+}
+
+// expired reports whether any cache layer has expired
+func (s *keySnapshot) expired(now time.Time) bool {
+	return now.After(s.htmlDataCache.ExpiresAt) ||
+		now.After(s.animationCache.ExpiresAt) ||
+		now.After(s.verificationCache.ExpiresAt)
+}
+
+// Clock supplies the time embedded in transaction IDs. Setting
+// ProductionConfig.Clock to a fixed clock makes Generate deterministic in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface
+type ClockFunc func() time.Time
+
+// Now returns f()
+func (f ClockFunc) Now() time.Time {
+	return f()
 }
 
 // CacheEntry represents a cached piece of data with expiration
@@ -71,6 +175,8 @@ type GeneratorMetrics struct {
 	RefreshFailures    int64     `json:"refresh_failures"`
 	AverageGenTime     float64   `json:"average_generation_time_ms"`
 	LastRefreshTime    time.Time `json:"last_refresh_time"`
+	StoreHits          int64     `json:"store_hits"`   // Warm starts from the KeyMaterialStore
+	StoreErrors        int64     `json:"store_errors"` // Failed KeyMaterialStore loads and saves
 }
 
 // NewTransactionGenerator creates a unified transaction generator
@@ -80,28 +186,81 @@ func NewTransactionGenerator() (*TransactionGenerator, error) {
 
 // NewTransactionGeneratorWithConfig creates a transaction generator with custom config
 func NewTransactionGeneratorWithConfig(config *ProductionConfig) (*TransactionGenerator, error) {
+	return NewTransactionGeneratorContext(context.Background(), config)
+}
+
+// NewTransactionGeneratorContext creates a transaction generator, fetching the
+// key material with ctx unless config.LazyInitialization defers it to the
+// first Generate call
+func NewTransactionGeneratorContext(ctx context.Context, config *ProductionConfig) (*TransactionGenerator, error) {
 	if config == nil {
 		config = DefaultProductionConfig()
 	}
-	
+	httpClient, _, err := config.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	profile := config.browserProfile()
+	return newTransactionGenerator(ctx, config, func() (*http.Client, *BrowserProfile) {
+		return httpClient, profile
+	})
+}
+
+// newTransactionGenerator creates a transaction generator that downloads its
+// sources with the HTTP client and browser profile fetchAs returns
+func newTransactionGenerator(ctx context.Context, config *ProductionConfig, fetchAs fetchTransport) (*TransactionGenerator, error) {
+	lifetime, cancel := context.WithCancel(context.Background())
 	generator := &TransactionGenerator{
-		config:  config,
-		metrics: &GeneratorMetrics{},
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		config:     config,
+		metrics:    &GeneratorMetrics{},
+		fetchAs:    fetchAs,
+		ctx:        lifetime,
+		cancel:     cancel,
+	}
+	
+	if config.LazyInitialization {
+		return generator, nil
 	}
 	
 	// Initialize with fresh data
-	if err := generator.initialize(); err != nil {
+	if err := generator.initialize(ctx); err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to initialize transaction generator: %w", err)
 	}
 	
+	generator.startRefreshLoop()
 	return generator, nil
 }
 
+// Close cancels any in-flight refresh, stops the background refresh loop and
+// prevents future refreshes. Transaction IDs can still be generated from key
+// material that was already fetched.
+func (tg *TransactionGenerator) Close() error {
+	tg.cancel()
+	return nil
+}
+
+// boundContext returns a context that is cancelled when either ctx is
+// cancelled or the generator is closed
+func (tg *TransactionGenerator) boundContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	bound, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(tg.ctx, cancel)
+	return bound, func() {
+		stop()
+		cancel()
+	}
+}
+
+// isInitialized reports whether key material has been fetched at least once
+func (tg *TransactionGenerator) isInitialized() bool {
+	return tg.snapshot.Load() != nil
+}
+
 // initialize fetches initial data and sets up caches
-func (tg *TransactionGenerator) initialize() error {
+func (tg *TransactionGenerator) initialize(ctx context.Context) error {
+	ctx, cancel := tg.boundContext(ctx)
+	defer cancel()
+	
 	tg.refreshMutex.Lock()
 	defer tg.refreshMutex.Unlock()
 	
@@ -110,45 +269,20 @@ func (tg *TransactionGenerator) initialize() error {
 		tg.updateGenerationTime(time.Since(start))
 	}()
 	
-	// Fetch real data from Twitter
-	if err := tg.fetchTwitterData(); err != nil {
-		return fmt.Errorf("failed to fetch Twitter data: %w", err)
-	}
-	
-	// Extract real algorithm data
-	if err := tg.extractAlgorithmData(); err != nil {
-		return fmt.Errorf("failed to extract algorithm data: %w", err)
-	}
-	
-	// Initialize cache entries with real data
-	now := time.Now()
-	tg.htmlDataCache = &CacheEntry{
-		Data:      map[string]string{"homepage": tg.homePageHTML, "ondemand": tg.onDemandFileHTML},
-		CreatedAt: now,
-		ExpiresAt: now.Add(tg.config.HTMLDataCacheLifetime),
-	}
-	
-	tg.animationCache = &CacheEntry{
-		Data:      tg.animationKey,
-		CreatedAt: now,
-		ExpiresAt: now.Add(tg.config.AnimationKeyLifetime),
-	}
-	
-	tg.verificationCache = &CacheEntry{
-		Data:      tg.key,
-		CreatedAt: now,
-		ExpiresAt: now.Add(tg.config.HTMLDataCacheLifetime),
-	}
-	
-	tg.initialized = true
-	tg.lastRefresh = now
-	tg.metrics.LastRefreshTime = now
-	
-	return nil
+	// Warm start from key material persisted by an earlier process,
+	// otherwise fetch real data from Twitter
+	return tg.refreshKeyMaterial(ctx)
 }
 
 // Generate creates a new transaction ID with intelligent caching
 func (tg *TransactionGenerator) Generate(method, path string) (string, error) {
+	return tg.GenerateContext(context.Background(), method, path)
+}
+
+// GenerateContext creates a new transaction ID, using ctx for any refresh of
+// expired key material. With lazy initialization the first call fetches the
+// key material and fails if that fetch fails.
+func (tg *TransactionGenerator) GenerateContext(ctx context.Context, method, path string) (string, error) {
 	start := time.Now()
 	defer func() {
 		tg.updateGenerationTime(time.Since(start))
@@ -157,10 +291,16 @@ func (tg *TransactionGenerator) Generate(method, path string) (string, error) {
 	
 	// Check if we need to refresh any cached data
 	if tg.needsRefresh() {
-		if err := tg.Refresh(); err != nil {
-			// Log error but continue with potentially stale data
-			// In production, this would be logged to monitoring system
+		if tg.config.BackgroundRefresh && tg.isInitialized() {
+			// Stale while revalidate: keep serving the current material
+			tg.triggerRefresh(false)
+		} else if err := tg.refreshIfNeeded(ctx); err != nil && !tg.isInitialized() {
+			// Without any key material there is nothing to generate from
+			return "", fmt.Errorf("transaction generator not initialized: %w", err)
+		} else if err == nil {
+			tg.startRefreshLoop()
 		}
+		// Otherwise continue with potentially stale data
 	}
 	
 	// Generate unique transaction ID
@@ -169,80 +309,209 @@ func (tg *TransactionGenerator) Generate(method, path string) (string, error) {
 
 // needsRefresh checks if any cached data needs refreshing based on production config
 func (tg *TransactionGenerator) needsRefresh() bool {
-	tg.mu.RLock()
-	defer tg.mu.RUnlock()
+	// Supplied sources are only replaced through UpdateSources
+	if tg.staticSources {
+		return false
+	}
+	
+	snapshot := tg.snapshot.Load()
+	return snapshot == nil || snapshot.expired(tg.config.clock().Now())
+}
+
+// Refresh refreshes all cached data. It is aborted when ctx is cancelled or
+// the generator is closed.
+func (tg *TransactionGenerator) Refresh(ctx context.Context) error {
+	tg.refreshMutex.Lock()
+	defer tg.refreshMutex.Unlock()
 	
-	if !tg.initialized {
-		return true
+	return tg.refreshLocked(ctx)
+}
+
+// refreshIfNeeded refreshes unless a concurrent caller already did while we
+// waited for the refresh lock
+func (tg *TransactionGenerator) refreshIfNeeded(ctx context.Context) error {
+	tg.refreshMutex.Lock()
+	defer tg.refreshMutex.Unlock()
+	
+	if !tg.needsRefresh() {
+		return nil
+	}
+	return tg.refreshLocked(ctx)
+}
+
+// refreshLocked fetches and applies fresh key material. The caller must hold refreshMutex.
+func (tg *TransactionGenerator) refreshLocked(ctx context.Context) error {
+	if tg.staticSources {
+		return fmt.Errorf("transaction generator was built from sources; use UpdateSources")
 	}
 	
-	now := time.Now()
+	ctx, cancel := tg.boundContext(ctx)
+	defer cancel()
 	
-	// Check each cache layer
-	if tg.htmlDataCache != nil && now.After(tg.htmlDataCache.ExpiresAt) {
-		return true
+	err := tg.refreshKeyMaterial(ctx)
+	tg.recordRefreshResult(err)
+	return err
+}
+
+// refreshKeyMaterial loads newer key material from the store or fetches it
+func (tg *TransactionGenerator) refreshKeyMaterial(ctx context.Context) error {
+	// Another process may already have stored newer key material
+	if tg.loadKeyMaterial(ctx) {
+		return nil
 	}
 	
-	if tg.animationCache != nil && now.After(tg.animationCache.ExpiresAt) {
-		return true
+	snapshot, err := tg.fetchKeySnapshot(ctx)
+	if err != nil {
+		return err
+	}
+	
+	tg.publish(snapshot)
+	tg.saveKeyMaterial(ctx)
+	return nil
+}
+
+// fetchKeySnapshot downloads and extracts key material into a new snapshot,
+// so the live material keeps serving until it is published
+func (tg *TransactionGenerator) fetchKeySnapshot(ctx context.Context) (*keySnapshot, error) {
+	// Fetch real data from Twitter
+	homeHTML, onDemandJS, err := tg.fetchTwitterData(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Twitter data: %w", err)
 	}
 	
-	if tg.verificationCache != nil && now.After(tg.verificationCache.ExpiresAt) {
-		return true
+	// Extract real algorithm data
+	snapshot, err := newKeySnapshot(homeHTML, onDemandJS, tg.config.extractors())
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract algorithm data: %w", err)
 	}
 	
-	return false
+	now := tg.config.clock().Now()
+	return snapshot.withExpiry(now, now.Add(tg.config.HTMLDataCacheLifetime), now.Add(tg.config.AnimationKeyLifetime)), nil
 }
 
-// Refresh refreshes all cached data
-func (tg *TransactionGenerator) Refresh() error {
-	tg.refreshMutex.Lock()
-	defer tg.refreshMutex.Unlock()
+// publish makes a snapshot the current key material. The caller must hold refreshMutex.
+func (tg *TransactionGenerator) publish(snapshot *keySnapshot) {
+	previous := tg.snapshot.Swap(snapshot)
 	
-	tg.metrics.RefreshAttempts++
+	tg.mu.Lock()
+	tg.metrics.LastRefreshTime = snapshot.fetchedAt
+	tg.mu.Unlock()
 	
-	// Fetch fresh data from Twitter using real algorithm
-	if err := tg.fetchTwitterData(); err != nil {
-		tg.metrics.RefreshFailures++
-		return fmt.Errorf("failed to fetch Twitter data: %w", err)
+	tg.observe(previous, snapshot)
+}
+
+// keyMaterial returns the current key material in its persisted form
+func (tg *TransactionGenerator) keyMaterial() *KeyMaterial {
+	snapshot := tg.snapshot.Load()
+	return &KeyMaterial{
+		Version:            keyMaterialVersion,
+		Source:             tg.config.endpoints().HomeURL(),
+		HomePageHTML:       snapshot.homePageHTML,
+		OnDemandFileHTML:   snapshot.onDemandFileHTML,
+		Key:                snapshot.key,
+		KeyBytes:           append([]int(nil), snapshot.keyBytes...),
+		RowIndex:           snapshot.rowIndex,
+		KeyBytesIndices:    append([]int(nil), snapshot.keyBytesIndices...),
+		AnimationKey:       snapshot.animationKey,
+		FetchedAt:          snapshot.fetchedAt,
+		HTMLExpiresAt:      snapshot.htmlDataCache.ExpiresAt,
+		AnimationExpiresAt: snapshot.animationCache.ExpiresAt,
+	}
+}
+
+// snapshotFromMaterial rebuilds a snapshot from persisted key material
+func snapshotFromMaterial(material *KeyMaterial) *keySnapshot {
+	snapshot := &keySnapshot{
+		homePageHTML:     material.HomePageHTML,
+		onDemandFileHTML: material.OnDemandFileHTML,
+		key:              material.Key,
+		keyBytes:         append([]int(nil), material.KeyBytes...),
+		rowIndex:         material.RowIndex,
+		keyBytesIndices:  append([]int(nil), material.KeyBytesIndices...),
+		animationKey:     material.AnimationKey,
+		onDemandHash:     onDemandHash(material.HomePageHTML),
+	}
+	return snapshot.withExpiry(material.FetchedAt, material.HTMLExpiresAt, material.AnimationExpiresAt)
+}
+
+// loadKeyMaterial applies key material from the configured store if it is
+// unexpired, was fetched for the same homepage and is newer than ours
+func (tg *TransactionGenerator) loadKeyMaterial(ctx context.Context) bool {
+	store := tg.config.KeyMaterialStore
+	if store == nil {
+		return false
 	}
 	
-	// Re-extract algorithm data from fresh HTML
-	if err := tg.extractAlgorithmData(); err != nil {
-		tg.metrics.RefreshFailures++
-		return fmt.Errorf("failed to extract algorithm data: %w", err)
+	material, err := store.Load(ctx)
+	if err != nil {
+		tg.recordStoreError(err)
+		return false
+	}
+	if material == nil || material.Version != keyMaterialVersion ||
+		material.Source != tg.config.endpoints().HomeURL() || material.Expired(tg.config.clock().Now()) ||
+		len(material.KeyBytes) == 0 || material.AnimationKey == "" {
+		return false
 	}
 	
-	// Update caches with fresh data
-	if err := tg.updateCachesWithFreshData(); err != nil {
-		tg.metrics.RefreshFailures++
-		return fmt.Errorf("failed to update caches: %w", err)
+	if current := tg.snapshot.Load(); current != nil && !material.FetchedAt.After(current.fetchedAt) {
+		return false
 	}
 	
+	tg.publish(snapshotFromMaterial(material))
 	tg.mu.Lock()
-	tg.lastRefresh = time.Now()
-	tg.metrics.LastRefreshTime = tg.lastRefresh
+	tg.metrics.StoreHits++
 	tg.mu.Unlock()
 	
-	return nil
+	if tg.config.EnableDebugLogging {
+		fmt.Printf("🔑 Loaded key material fetched at %s from store\n", material.FetchedAt.Format(time.RFC3339))
+	}
+	return true
 }
 
-// ForceRefresh immediately refreshes all data regardless of cache expiration
-func (tg *TransactionGenerator) ForceRefresh() error {
-	// Invalidate all caches
-	tg.mu.Lock()
-	if tg.htmlDataCache != nil {
-		tg.htmlDataCache.ExpiresAt = time.Now().Add(-1 * time.Hour)
-	}
-	if tg.animationCache != nil {
-		tg.animationCache.ExpiresAt = time.Now().Add(-1 * time.Hour)
+// saveKeyMaterial persists freshly fetched key material to the configured store
+func (tg *TransactionGenerator) saveKeyMaterial(ctx context.Context) {
+	store := tg.config.KeyMaterialStore
+	if store == nil {
+		return
 	}
-	if tg.verificationCache != nil {
-		tg.verificationCache.ExpiresAt = time.Now().Add(-1 * time.Hour)
+	if err := store.Save(ctx, tg.keyMaterial()); err != nil {
+		tg.recordStoreError(err)
 	}
+}
+
+// recordStoreError counts a store failure; the generator keeps working from the network
+func (tg *TransactionGenerator) recordStoreError(err error) {
+	tg.mu.Lock()
+	tg.metrics.StoreErrors++
 	tg.mu.Unlock()
 	
-	return tg.Refresh()
+	if tg.config.EnableDebugLogging {
+		fmt.Printf("⚠️ Key material store error: %v\n", err)
+	}
+}
+
+// ForceRefresh immediately refreshes all data regardless of cache expiration
+func (tg *TransactionGenerator) ForceRefresh() error {
+	return tg.forceRefresh(context.Background())
+}
+
+// forceRefresh expires every cache layer and refreshes with ctx
+func (tg *TransactionGenerator) forceRefresh(ctx context.Context) error {
+	tg.refreshMutex.Lock()
+	defer tg.refreshMutex.Unlock()
+	
+	// Invalidate all caches, so a failed refresh is retried by the next request
+	tg.expire()
+	return tg.refreshLocked(ctx)
+}
+
+// expire republishes the current key material with every cache layer
+// expired. The caller must hold refreshMutex.
+func (tg *TransactionGenerator) expire() {
+	if current := tg.snapshot.Load(); current != nil {
+		expired := tg.config.clock().Now().Add(-1 * time.Hour)
+		tg.snapshot.Store(current.withExpiry(current.fetchedAt, expired, expired))
+	}
 }
 
 // ForceRefreshTransactionID is an alias for backward compatibility
@@ -250,40 +519,39 @@ func (tg *TransactionGenerator) ForceRefreshTransactionID() error {
 	return tg.ForceRefresh()
 }
 
-// updateCachesWithFreshData updates all caches with freshly fetched data
-func (tg *TransactionGenerator) updateCachesWithFreshData() error {
-	now := time.Now()
-	
-	// Update HTML data cache
-	tg.htmlDataCache = &CacheEntry{
-		Data:      map[string]string{"homepage": tg.homePageHTML, "ondemand": tg.onDemandFileHTML},
-		CreatedAt: now,
-		ExpiresAt: now.Add(tg.config.HTMLDataCacheLifetime),
-	}
-	
-	// Update animation cache
-	tg.animationCache = &CacheEntry{
-		Data:      tg.animationKey,
-		CreatedAt: now,
-		ExpiresAt: now.Add(tg.config.AnimationKeyLifetime),
-	}
-	
-	// Update verification cache
-	tg.verificationCache = &CacheEntry{
-		Data:      tg.key,
-		CreatedAt: now,
-		ExpiresAt: now.Add(tg.config.HTMLDataCacheLifetime),
+// generateUniqueTransactionID generates a unique transaction ID using the
+// configured clock and random source (the system clock and crypto/rand by default)
+func (tg *TransactionGenerator) generateUniqueTransactionID(method, path string) (string, error) {
+	// Generate random XOR byte
+	var randomBytes [1]byte
+	if _, err := io.ReadFull(tg.config.random(), randomBytes[:]); err != nil {
+		return "", fmt.Errorf("failed to generate random number: %w", err)
 	}
 	
-	return nil
+	return tg.GenerateAt(method, path, tg.config.clock().Now(), randomBytes[0])
 }
 
-// generateUniqueTransactionID generates a unique transaction ID using crypto/rand
-func (tg *TransactionGenerator) generateUniqueTransactionID(method, path string) (string, error) {
-	// Calculate precise timestamp
-	nowMicro := time.Now().UnixMicro()
-	epochMicro := int64(TwitterEpoch) * 1000000
-	timeNow := int64((nowMicro - epochMicro) / 1000000)
+// GenerateAt creates the transaction ID for a request made at t, encrypted
+// with the given XOR byte, from the current key material as-is. It never
+// refreshes, so the same key material and inputs always give the same ID,
+// which makes it suitable for golden tests and for comparing against other
+// implementations.
+//
+// Example:
+//
+//	tg, _ := xapi.NewTransactionGeneratorFromSources(homeHTML, onDemandJS)
+//	id, err := tg.GenerateAt("GET", "/i/api/graphql/abc/UserByScreenName", time.Unix(1700000000, 0), 0x5a)
+func (tg *TransactionGenerator) GenerateAt(method, path string, t time.Time, xorByte byte) (string, error) {
+	snapshot := tg.snapshot.Load()
+	if snapshot == nil {
+		return "", fmt.Errorf("transaction generator not initialized")
+	}
+	return snapshot.transactionID(method, path, t, xorByte), nil
+}
+
+// transactionID derives the transaction ID for a request at t from the snapshot's key material
+func (s *keySnapshot) transactionID(method, path string, t time.Time, xorByte byte) string {
+	timeNow := transactionTime(t)
 	
 	// Convert time to bytes (little endian)
 	timeNowBytes := make([]byte, 4)
@@ -291,27 +559,14 @@ func (tg *TransactionGenerator) generateUniqueTransactionID(method, path string)
 		timeNowBytes[i] = byte((timeNow >> (i * 8)) & 0xFF)
 	}
 	
-	// Create hash string with current animation key
-	tg.mu.RLock()
-	currentAnimationKey := tg.animationKey
-	currentKeyBytes := tg.keyBytes
-	tg.mu.RUnlock()
-	
-	hashString := fmt.Sprintf("%s!%s!%d%s%s", method, path, timeNow, DefaultKeyword, currentAnimationKey)
-	hash := sha256.Sum256([]byte(hashString))
-	hashBytes := hash[:16]
-	
-	// Generate random XOR byte using crypto/rand
-	var randomBytes [1]byte
-	if _, err := rand.Read(randomBytes[:]); err != nil {
-		return "", fmt.Errorf("failed to generate random number: %w", err)
-	}
+	// Create hash with the snapshot's animation key
+	hashBytes := transactionHash(method, path, timeNow, s.animationKey)
 	
 	// Build final byte array
 	var bytesArr []byte
 	
 	// Add key bytes (convert from []int to []byte)
-	for _, kb := range currentKeyBytes {
+	for _, kb := range s.keyBytes {
 		bytesArr = append(bytesArr, byte(kb))
 	}
 	
@@ -320,135 +575,124 @@ func (tg *TransactionGenerator) generateUniqueTransactionID(method, path string)
 	bytesArr = append(bytesArr, byte(AdditionalRandomNumber))
 	
 	// XOR encrypt
-	result := []byte{randomBytes[0]}
+	result := []byte{xorByte}
 	for _, b := range bytesArr {
-		result = append(result, b^randomBytes[0])
+		result = append(result, b^xorByte)
 	}
 	
 	// Base64 encode and remove padding
 	encoded := base64.StdEncoding.EncodeToString(result)
-	return trimBase64Padding(encoded), nil
+	return trimBase64Padding(encoded)
+}
+
+// transactionTime returns the whole seconds between TwitterEpoch and t
+func transactionTime(t time.Time) int64 {
+	nowMicro := t.UnixMicro()
+	epochMicro := int64(TwitterEpoch) * 1000000
+	return int64((nowMicro - epochMicro) / 1000000)
+}
+
+// transactionHash returns the 16-byte hash prefix embedded in a transaction ID
+func transactionHash(method, path string, timeNow int64, animationKey string) []byte {
+	hashString := fmt.Sprintf("%s!%s!%d%s%s", method, path, timeNow, DefaultKeyword, animationKey)
+	hash := sha256.Sum256([]byte(hashString))
+	return hash[:16]
 }
 
 // Real algorithm implementation methods
 
-// fetchTwitterData fetches the required HTML data from Twitter
-func (tg *TransactionGenerator) fetchTwitterData() error {
+// fetchTwitterData fetches the homepage HTML and the ondemand.s file it references
+func (tg *TransactionGenerator) fetchTwitterData(ctx context.Context) (homeHTML, onDemandJS string, err error) {
 	// Fetch home page
-	req, err := http.NewRequest("GET", "https://x.com", nil)
+	endpoints := tg.config.endpoints()
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoints.HomeURL(), nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	// Both downloads present the same browser through the same transport
+	httpClient, profile := tg.fetchAs()
+	req = profile.apply(req)
 
-	resp, err := tg.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to fetch home page: %w", err)
+		return "", "", fmt.Errorf("failed to fetch home page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	homeBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read home page: %w", err)
+		return "", "", fmt.Errorf("failed to read home page: %w", err)
 	}
-	tg.homePageHTML = string(homeBytes)
+	homeHTML = string(homeBytes)
+	tg.mu.Lock()
 	tg.metrics.HTMLDataFetches++
+	tg.mu.Unlock()
 
 	// Extract ondemand file URL
-	onDemandFileRegex := regexp.MustCompile(`['\"]{1}ondemand\.s['\"]{1}:\s*['\"]{1}([\w]*)['\"]{1}`)
-	matches := onDemandFileRegex.FindStringSubmatch(tg.homePageHTML)
-	if len(matches) < 2 {
-		return fmt.Errorf("ondemand file URL not found in home page")
+	hash := onDemandHash(homeHTML)
+	if hash == "" {
+		return "", "", fmt.Errorf("ondemand file URL not found in home page")
 	}
 
-	onDemandURL := fmt.Sprintf("https://abs.twimg.com/responsive-web/client-web/ondemand.s.%sa.js", matches[1])
+	onDemandURL := endpoints.OnDemandURL(hash)
 
 	// Fetch ondemand file
-	req, err = http.NewRequest("GET", onDemandURL, nil)
+	req, err = http.NewRequestWithContext(ctx, "GET", onDemandURL, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create ondemand request: %w", err)
+		return "", "", fmt.Errorf("failed to create ondemand request: %w", err)
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.0.0 Safari/537.36")
+	req = profile.apply(req)
 
-	resp, err = tg.httpClient.Do(req)
+	resp, err = httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to fetch ondemand file: %w", err)
+		return "", "", fmt.Errorf("failed to fetch ondemand file: %w", err)
 	}
 	defer resp.Body.Close()
 
 	onDemandBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read ondemand file: %w", err)
+		return "", "", fmt.Errorf("failed to read ondemand file: %w", err)
 	}
-	tg.onDemandFileHTML = string(onDemandBytes)
-
-	return nil
+	return homeHTML, string(onDemandBytes), nil
 }
 
-// extractAlgorithmData extracts keys and generates animation data using the corrected algorithm
-func (tg *TransactionGenerator) extractAlgorithmData() error {
-	// Extract indices from ondemand file
-	if err := tg.extractIndices(); err != nil {
-		return fmt.Errorf("failed to extract indices: %w", err)
-	}
-
+// extractAlgorithmData extracts keys and generates animation data using the
+// corrected algorithm. The key comes first so the extractor self-checks can
+// validate indices against it.
+func (s *keySnapshot) extractAlgorithmData(extractors []Extractor) error {
 	// Extract key from home page
-	if err := tg.extractKey(); err != nil {
-		return fmt.Errorf("failed to extract key: %w", err)
-	}
-
-	// Generate animation key using corrected matrix algorithm
-	if err := tg.generateAnimationKey(); err != nil {
-		return fmt.Errorf("failed to generate animation key: %w", err)
+	if err := s.extractKey(); err != nil {
+		return &ExtractionError{Step: StepExtractKey, Err: err}
 	}
 
-	return nil
-}
-
-// extractIndices extracts the dynamic indices from the ondemand.s file
-func (tg *TransactionGenerator) extractIndices() error {
-	indicesRegex := regexp.MustCompile(`\(\w{1}\[(\d{1,2})\],\s*16\)`)
-	matches := indicesRegex.FindAllStringSubmatch(tg.onDemandFileHTML, -1)
-	if len(matches) == 0 {
-		return fmt.Errorf("no indices found in ondemand file")
-	}
-
-	var indices []int
-	for _, match := range matches {
-		if len(match) > 1 {
-			index, err := strconv.Atoi(match[1])
-			if err != nil {
-				return fmt.Errorf("failed to parse index %s: %w", match[1], err)
-			}
-			indices = append(indices, index)
-		}
+	// Extract indices from ondemand file
+	if err := s.extractIndices(extractors); err != nil {
+		return &ExtractionError{Step: StepExtractIndices, Err: err}
 	}
 
-	if len(indices) == 0 {
-		return fmt.Errorf("no valid indices extracted")
+	// Generate animation key using corrected matrix algorithm
+	if err := s.generateAnimationKey(extractors); err != nil {
+		return &ExtractionError{Step: StepGenerateAnimationKey, Err: err}
 	}
 
-	tg.rowIndex = indices[0]
-	tg.keyBytesIndices = indices[1:]
 	return nil
 }
 
 // extractKey extracts the twitter-site-verification key from the home page
-func (tg *TransactionGenerator) extractKey() error {
-	doc, err := html.Parse(strings.NewReader(tg.homePageHTML))
+func (s *keySnapshot) extractKey() error {
+	doc, err := html.Parse(strings.NewReader(s.homePageHTML))
 	if err != nil {
 		return fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
-	key := tg.findTwitterSiteVerification(doc)
+	key := s.findTwitterSiteVerification(doc)
 	if key == "" {
 		return fmt.Errorf("twitter-site-verification meta tag not found")
 	}
 
-	tg.key = key
+	s.key = key
 
 	// Decode key bytes
 	decoded, err := base64.StdEncoding.DecodeString(key)
@@ -456,16 +700,16 @@ func (tg *TransactionGenerator) extractKey() error {
 		return fmt.Errorf("failed to decode key: %w", err)
 	}
 
-	tg.keyBytes = make([]int, len(decoded))
+	s.keyBytes = make([]int, len(decoded))
 	for i, b := range decoded {
-		tg.keyBytes[i] = int(b)
+		s.keyBytes[i] = int(b)
 	}
 
 	return nil
 }
 
 // findTwitterSiteVerification recursively searches for the twitter-site-verification meta tag
-func (tg *TransactionGenerator) findTwitterSiteVerification(n *html.Node) string {
+func (s *keySnapshot) findTwitterSiteVerification(n *html.Node) string {
 	if n.Type == html.ElementNode && n.Data == "meta" {
 		var name, content string
 		for _, attr := range n.Attr {
@@ -482,7 +726,7 @@ func (tg *TransactionGenerator) findTwitterSiteVerification(n *html.Node) string
 	}
 
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		if result := tg.findTwitterSiteVerification(c); result != "" {
+		if result := s.findTwitterSiteVerification(c); result != "" {
 			return result
 		}
 	}
@@ -491,128 +735,58 @@ func (tg *TransactionGenerator) findTwitterSiteVerification(n *html.Node) string
 }
 
 // generateAnimationKey generates the animation key using frame data and timing (WITH CORRECTED MATRIX)
-func (tg *TransactionGenerator) generateAnimationKey() error {
-	// Extract animation frames from the HTML (2D array)
-	frames, err := tg.extractAnimationFrames()
-	if err != nil {
-		return fmt.Errorf("failed to extract animation frames: %w", err)
+func (s *keySnapshot) generateAnimationKey(extractors []Extractor) error {
+	// Select the frame using key_bytes[5] % 4 (Python approach)
+	if len(s.keyBytes) <= 5 {
+		return fmt.Errorf("key_bytes too short for frame selection")
 	}
 
 	// Calculate frame timing - match Python exactly
-	actualRowIndex := tg.rowIndex
-	if actualRowIndex >= len(tg.keyBytes) {
-		actualRowIndex = len(tg.keyBytes) - 1
+	actualRowIndex := s.rowIndex
+	if actualRowIndex >= len(s.keyBytes) {
+		actualRowIndex = len(s.keyBytes) - 1
 	}
-	rowIndex := tg.keyBytes[actualRowIndex] % 16
+	rowIndex := s.keyBytes[actualRowIndex] % 16
 
 	frameTime := 1
-	for _, index := range tg.keyBytesIndices {
-		if index < len(tg.keyBytes) {
-			frameTime *= tg.keyBytes[index] % 16
+	for _, index := range s.keyBytesIndices {
+		if index < len(s.keyBytes) {
+			frameTime *= s.keyBytes[index] % 16
 		}
 	}
 	frameTime = int(jsRound(float64(frameTime)/10)) * 10
 
+	// Extract the selected animation frame from the HTML (2D array)
+	frames, err := s.extractAnimationFrame(extractors, s.keyBytes[5]%4, rowIndex)
+	if err != nil {
+		return fmt.Errorf("failed to extract animation frames: %w", err)
+	}
+
 	// Select the frame row - Python: frame_row = arr[row_index]
 	var frameRow []int
-	if len(frames) == 0 {
-		return fmt.Errorf("no frame data available")
-	}
-	
 	if rowIndex < len(frames) {
 		frameRow = frames[rowIndex]
 	} else {
 		frameRow = frames[0] // Fallback to first row
+		s.frameRowFallback = true
 	}
+	s.frameIndex = s.keyBytes[5] % 4
+	s.frameRow = rowIndex
+	s.frameRowLength = len(frameRow)
 
 	// Calculate target time
 	targetTime := float64(frameTime) / 4096.0
 
 	// Generate animation key using corrected algorithm
-	tg.animationKey = tg.animate(frameRow, targetTime)
+	s.animationKey = s.animate(frameRow, targetTime)
 	return nil
 }
 
-// extractAnimationFrames extracts row data from a single selected SVG animation frame
-func (tg *TransactionGenerator) extractAnimationFrames() ([][]int, error) {
-	// First, determine which frame to select using key_bytes[5] % 4 (Python approach)
-	if len(tg.keyBytes) <= 5 {
-		return nil, fmt.Errorf("key_bytes too short for frame selection")
-	}
-	
-	frameIndex := tg.keyBytes[5] % 4
-	frameID := fmt.Sprintf("loading-x-anim-%d", frameIndex)
-	
-	// Find the specific frame element using simple string search
-	framePattern := regexp.MustCompile(fmt.Sprintf(`id=['"]%s['"][^>]*>(.*?)</g>`, frameID))
-	frameMatch := framePattern.FindStringSubmatch(tg.homePageHTML)
-	
-	if len(frameMatch) < 2 {
-		return nil, fmt.Errorf("❌ EXTRACTION FAILED: frame %s not found in HTML - no fallback", frameID)
-	}
-	
-	frameContent := frameMatch[1]
-	
-	// Look for path elements within the frame content
-	pathPattern := regexp.MustCompile(`<path[^>]*\sd=['"]([^'"]*?)['"][^>]*>`)
-	pathMatches := pathPattern.FindAllStringSubmatch(frameContent, -1)
-	
-	var selectedPathData string
-	for _, pathMatch := range pathMatches {
-		if len(pathMatch) >= 2 && len(pathMatch[1]) > 9 && strings.Contains(pathMatch[1], "C") {
-			selectedPathData = pathMatch[1]
-			break
-		}
-	}
-	
-	if selectedPathData == "" {
-		return nil, fmt.Errorf("❌ EXTRACTION FAILED: no valid path data found in frame %s - no fallback", frameID)
-	}
-	
-	// Extract data exactly as Python does: pathData[9:].split("C")
-	curveData := selectedPathData[9:]
-	curveParts := strings.Split(curveData, "C")
-	
-	var rows [][]int
-	// For each "C" segment, extract all numbers to create a row
-	for _, part := range curveParts {
-		if strings.TrimSpace(part) == "" {
-			continue
-		}
-		
-		// Replace all non-digits with spaces, then split
-		numberRegex := regexp.MustCompile(`[^\d]+`)
-		cleanedPart := numberRegex.ReplaceAllString(part, " ")
-		cleanedPart = strings.TrimSpace(cleanedPart)
-		
-		if cleanedPart == "" {
-			continue
-		}
-		
-		var row []int
-		for _, numStr := range strings.Fields(cleanedPart) {
-			if num, err := strconv.Atoi(numStr); err == nil {
-				row = append(row, num)
-			}
-		}
-		
-		if len(row) > 0 {
-			rows = append(rows, row)
-		}
-	}
-	
-	if len(rows) == 0 {
-		return nil, fmt.Errorf("❌ EXTRACTION FAILED: no valid rows extracted from frame %s - no fallback", frameID)
-	}
-	
-	return rows, nil
-}
-
 // animate performs the cubic bezier animation calculation WITH CORRECTED MATRIX ORDERING
-func (tg *TransactionGenerator) animate(frameRow []int, targetTime float64) string {
-	if len(frameRow) < 15 {
+func (s *keySnapshot) animate(frameRow []int, targetTime float64) string {
+	if len(frameRow) < animationRowLength {
 		// Pad with zeros if needed
-		for len(frameRow) < 15 {
+		for len(frameRow) < animationRowLength {
 			frameRow = append(frameRow, 0)
 		}
 	}
@@ -678,25 +852,26 @@ func (tg *TransactionGenerator) animate(frameRow []int, targetTime float64) stri
 	return strings.ToLower(result)
 }
 
-// Metrics and monitoring methods
+// Metrics and monitoring methods. The generation counters are atomic so
+// Generate never takes a lock.
 func (tg *TransactionGenerator) incrementTotalGenerations() {
-	tg.mu.Lock()
-	defer tg.mu.Unlock()
-	tg.metrics.TotalGenerations++
+	tg.generations.Add(1)
 }
 
 func (tg *TransactionGenerator) updateGenerationTime(duration time.Duration) {
-	tg.mu.Lock()
-	defer tg.mu.Unlock()
-	
 	genTimeMs := float64(duration.Nanoseconds()) / 1e6
 	
-	if tg.metrics.TotalGenerations == 1 {
-		tg.metrics.AverageGenTime = genTimeMs
-	} else {
-		// Exponential moving average
-		alpha := 0.1
-		tg.metrics.AverageGenTime = (1-alpha)*tg.metrics.AverageGenTime + alpha*genTimeMs
+	for {
+		old := tg.avgGenTime.Load()
+		average := genTimeMs
+		if tg.generations.Load() != 1 {
+			// Exponential moving average
+			alpha := 0.1
+			average = (1-alpha)*math.Float64frombits(old) + alpha*genTimeMs
+		}
+		if tg.avgGenTime.CompareAndSwap(old, math.Float64bits(average)) {
+			return
+		}
 	}
 }
 
@@ -706,6 +881,8 @@ func (tg *TransactionGenerator) GetMetrics() *GeneratorMetrics {
 	defer tg.mu.RUnlock()
 	
 	metrics := *tg.metrics
+	metrics.TotalGenerations = tg.generations.Load()
+	metrics.AverageGenTime = math.Float64frombits(tg.avgGenTime.Load())
 	return &metrics
 }
 
@@ -716,17 +893,37 @@ func (tg *TransactionGenerator) IsStale() bool {
 
 // GetStats returns information about the generator state
 func (tg *TransactionGenerator) GetStats() *TransactionGeneratorStats {
+	tg.flightMu.Lock()
+	nextRefresh := tg.nextRefresh
+	tg.flightMu.Unlock()
+	
+	snapshot := tg.snapshot.Load()
+	if snapshot == nil {
+		snapshot = &keySnapshot{}
+	}
+	
 	tg.mu.RLock()
 	defer tg.mu.RUnlock()
 	
+	var lastErr string
+	if tg.lastRefreshErr != nil {
+		lastErr = tg.lastRefreshErr.Error()
+	}
+	
 	return &TransactionGeneratorStats{
-		KeyLength:      len(tg.keyBytes),
-		IndicesCount:   len(tg.keyBytesIndices),
-		AnimationKey:   tg.animationKey,
-		LastFetchTime:  tg.lastRefresh,
+		KeyLength:      len(snapshot.keyBytes),
+		IndicesCount:   len(snapshot.keyBytesIndices),
+		AnimationKey:   snapshot.animationKey,
+		LastFetchTime:  snapshot.fetchedAt,
 		IsStale:        tg.needsRefresh(),
-		HomePageLength: len(tg.homePageHTML),
-		OnDemandLength: len(tg.onDemandFileHTML),
+		HomePageLength: len(snapshot.homePageHTML),
+		OnDemandLength: len(snapshot.onDemandFileHTML),
+		NextRefresh:    nextRefresh,
+		Extraction:     snapshot.extractionReport(),
+		
+		LastRefreshError:           lastErr,
+		LastRefreshErrorTime:       tg.lastRefreshErrAt,
+		ConsecutiveRefreshFailures: tg.refreshFailures,
 	}
 }
 
@@ -739,6 +936,13 @@ type TransactionGeneratorStats struct {
 	IsStale        bool      `json:"is_stale"`
 	HomePageLength int       `json:"home_page_length"`
 	OnDemandLength int       `json:"ondemand_length"`
+	NextRefresh    time.Time `json:"next_refresh,omitempty"` // Scheduled background refresh
+	Extraction     *ExtractionReport `json:"extraction,omitempty"` // Strategies that produced the key material; nil after a warm start
+	
+	// Last failed refresh, cleared once a refresh succeeds
+	LastRefreshError           string    `json:"last_refresh_error,omitempty"`
+	LastRefreshErrorTime       time.Time `json:"last_refresh_error_time,omitempty"`
+	ConsecutiveRefreshFailures int       `json:"consecutive_refresh_failures"`
 }
 
 // Utility functions
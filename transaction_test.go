@@ -0,0 +1,202 @@
+package xapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fixtureKeyFor returns a 48-byte verification key following i*mul+add
+func fixtureKeyFor(mul, add int) []byte {
+	key := make([]byte, 48)
+	for i := range key {
+		key[i] = byte(i*mul + add)
+	}
+	return key
+}
+
+// transactionVectors pin the derivation for the synthetic fixtures:
+// HTML fixture -> animation key -> transaction ID. A change to any value
+// means the derivation changed and will be rejected by the live API.
+//
+// None of them was captured from x.com. Each matches the output of a port of
+// the reference Python implementation (XClientTransaction) on the same fixtures.
+var transactionVectors = []struct {
+	name         string
+	key          []byte
+	frameSeed    int
+	columns      int // Frame row length, 11 if unset
+	indices      []int
+	animationKey string
+	ids          []transactionIDVector
+}{
+	{
+		name:         "default fixture",
+		key:          fixtureKeyBytes,
+		frameSeed:    53,
+		indices:      []int{7, 21, 33, 42},
+		animationKey: "96a7b8100100",
+		ids: []transactionIDVector{
+			{"GET", "/i/api/graphql/xc8f1g7BYqr6VTzTbvNlGw/UserByScreenName", 1700000000, 0x00,
+				"AAswVXqfxOkOM1h9osfsETZbgKXK7xQ5XoOozfIXPGGGq9D1Gj9kia7T+B1CZ4yx1pCNBAEWrAAiH+y1itqtMTQXzf0XAw"},
+			{"POST", "/i/api/1.1/jot/client_event.json", 1735689600, 0xa7,
+				"p6yX8t04Y06plP/aBWBLtpH8JwJtSLOe+SQPalWwm8YhDHdSvZjDLgl0X7rlwCsWcbeFgqSkjZhceeql8+viQrxUamV4pA"},
+		},
+	},
+	{
+		// Rows as long as animate reads, so none is padded
+		name:         "full rows",
+		key:          fixtureKeyFor(45, 7),
+		frameSeed:    37,
+		columns:      animationRowLength,
+		indices:      []int{1, 14, 31, 38},
+		animationKey: "7c8d9e0a3d70a3d70a3d80c51eb851eb8520c51eb851eb8520a3d70a3d70a3d800",
+		ids: []transactionIDVector{
+			{"GET", "/i/api/graphql/xc8f1g7BYqr6VTzTbvNlGw/UserByScreenName", 1700000000, 0x00,
+				"AAc0YY676BVCb5zJ9iNQfarXBDFei7jlEj9smcbzIE16p9QBLluIteIPPGmWw/AdSpCNBAHMkItGjbiRBRZ8RuzdqQLEAw"},
+			{"POST", "/i/api/1.1/jot/client_event.json", 1735689600, 0xa7,
+				"p6CTxikcT7LlyDtuUYT32g1wo5b5LB9CtZjLPmFUh+rdAHOmifwvEkWom84xZFe67beFgqSJRhKTY0wqDHpP0Lci6+vGpA"},
+		},
+	},
+}
+
+type transactionIDVector struct {
+	method  string
+	path    string
+	unix    int64
+	xorByte byte
+	want    string
+}
+
+func TestTransactionVectors(t *testing.T) {
+	for _, vector := range transactionVectors {
+		t.Run(vector.name, func(t *testing.T) {
+			columns := vector.columns
+			if columns == 0 {
+				columns = 11
+			}
+			tg, err := NewTransactionGeneratorFromSources(
+				fixtureHomeHTMLWithRows(vector.key, vector.frameSeed, columns), fixtureOnDemandJSFor(vector.indices...))
+			if err != nil {
+				t.Fatalf("Failed to create generator: %v", err)
+			}
+			defer tg.Close()
+
+			if got := tg.GetStats().AnimationKey; got != vector.animationKey {
+				t.Errorf("Animation key = %q, want %q", got, vector.animationKey)
+			}
+			for _, id := range vector.ids {
+				got, err := tg.GenerateAt(id.method, id.path, time.Unix(id.unix, 0), id.xorByte)
+				if err != nil {
+					t.Fatalf("GenerateAt failed: %v", err)
+				}
+				if got != id.want {
+					t.Errorf("%s %s at %d ^ %#02x:\n got %s\nwant %s", id.method, id.path, id.unix, id.xorByte, got, id.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransactionClockAndRandom(t *testing.T) {
+	server := newStandIn(t)
+	vector := transactionVectors[0].ids[1]
+
+	config := server.config()
+	config.Clock = ClockFunc(func() time.Time { return time.Unix(vector.unix, 0) })
+	config.Random = bytes.NewReader([]byte{vector.xorByte})
+
+	tg, err := NewTransactionGeneratorWithConfig(config)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	got, err := tg.Generate(vector.method, vector.path)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got != vector.want {
+		t.Errorf("Generate with fixed clock and randomness = %s, want %s", got, vector.want)
+	}
+
+	// An exhausted random source is an error, not a predictable ID
+	if _, err := tg.Generate(vector.method, vector.path); err == nil {
+		t.Error("Expected an error once the random source is exhausted")
+	}
+
+	if _, err := (&TransactionGenerator{}).GenerateAt("GET", "/", time.Now(), 0); err == nil {
+		t.Error("GenerateAt without key material should fail")
+	}
+}
+
+func TestDecodeTransactionID(t *testing.T) {
+	for _, vector := range transactionVectors {
+		for _, id := range vector.ids {
+			decoded, err := DecodeTransactionID(id.want, len(vector.key))
+			if err != nil {
+				t.Fatalf("%s: failed to decode %s: %v", vector.name, id.want, err)
+			}
+			if decoded.XORByte != id.xorByte || !bytes.Equal(decoded.KeyBytes, vector.key) ||
+				!decoded.Time().Equal(time.Unix(id.unix, 0)) || decoded.Trailer != AdditionalRandomNumber {
+				t.Errorf("%s: unexpected breakdown:\n%s", vector.name, decoded)
+			}
+			if err := decoded.Verify(id.method, id.path, vector.animationKey); err != nil {
+				t.Errorf("%s: %v", vector.name, err)
+			}
+			if err := decoded.Verify(id.method, id.path+"x", vector.animationKey); !errors.Is(err, ErrTransactionIDMismatch) {
+				t.Errorf("%s: expected a mismatch for another path, got %v", vector.name, err)
+			}
+			if err := decoded.Verify(id.method, id.path, "stale"); !errors.Is(err, ErrTransactionIDMismatch) {
+				t.Errorf("%s: expected a mismatch for another animation key, got %v", vector.name, err)
+			}
+		}
+	}
+
+	valid := transactionVectors[0].ids[0].want
+	raw, _ := base64.RawStdEncoding.DecodeString(valid)
+	raw[len(raw)-1] ^= 0xff
+	badTrailer := base64.RawStdEncoding.EncodeToString(raw)
+
+	for name, id := range map[string]string{
+		"not base64":   "!!!",
+		"truncated":    valid[:40],
+		"bad trailer":  badTrailer,
+		"wrong keylen": valid + "AAAA",
+	} {
+		if _, err := DecodeTransactionID(id, 48); !errors.Is(err, ErrMalformedTransactionID) {
+			t.Errorf("%s: expected ErrMalformedTransactionID, got %v", name, err)
+		}
+	}
+	if decoded, _ := DecodeTransactionID(badTrailer, 48); decoded == nil || decoded.Trailer == AdditionalRandomNumber {
+		t.Error("A bad trailer should still return the breakdown")
+	}
+}
+
+func TestInspectTransactionID(t *testing.T) {
+	tg, err := NewTransactionGeneratorFromSources(fixtureHomeHTML(), fixtureOnDemandJS())
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	defer tg.Close()
+
+	id, err := tg.Generate("GET", "/graphql/abc/UserByScreenName")
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if _, err := tg.InspectTransactionID(id, "GET", "/graphql/abc/UserByScreenName"); err != nil {
+		t.Errorf("Generated ID should verify: %v", err)
+	}
+	if _, err := tg.InspectTransactionID(id, "POST", "/graphql/abc/UserByScreenName"); !errors.Is(err, ErrTransactionIDMismatch) {
+		t.Errorf("Expected a mismatch for another method, got %v", err)
+	}
+
+	// An ID made with another verification key is caught before the hash
+	other := transactionVectors[1]
+	otherID := other.ids[0]
+	if _, err := tg.InspectTransactionID(otherID.want, otherID.method, otherID.path); !errors.Is(err, ErrTransactionIDMismatch) {
+		t.Errorf("Expected a key mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package xapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// transactionHashLength is the length of the SHA-256 prefix embedded in a transaction ID
+const transactionHashLength = 16
+
+// DecodedTransactionID is the breakdown of an X-Client-Transaction-Id value
+type DecodedTransactionID struct {
+	XORByte    byte   `json:"xor_byte"`    // Leading random byte the rest of the ID is XORed with
+	KeyBytes   []byte `json:"key_bytes"`   // twitter-site-verification key bytes
+	TimeOffset uint32 `json:"time_offset"` // Seconds since TwitterEpoch, little endian in the ID
+	Hash       []byte `json:"hash"`        // SHA-256 prefix over method, path, time and animation key
+	Trailer    byte   `json:"trailer"`     // AdditionalRandomNumber in well-formed IDs
+}
+
+// Time returns when the ID was generated, to the second
+func (d *DecodedTransactionID) Time() time.Time {
+	return time.Unix(TwitterEpoch+int64(d.TimeOffset), 0).UTC()
+}
+
+// Verify checks the embedded hash against the request method, path and the
+// animation key the ID should have been generated with. A mismatch returns
+// an error wrapping ErrTransactionIDMismatch.
+func (d *DecodedTransactionID) Verify(method, path, animationKey string) error {
+	want := transactionHash(method, path, int64(d.TimeOffset), animationKey)
+	if !bytes.Equal(want, d.Hash) {
+		return fmt.Errorf("%w: %s %s at %s hashes to %x, ID carries %x",
+			ErrTransactionIDMismatch, method, path, d.Time().Format(time.RFC3339), want, d.Hash)
+	}
+	return nil
+}
+
+// String formats the breakdown one field per line
+func (d *DecodedTransactionID) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "xor byte:  0x%02x\n", d.XORByte)
+	fmt.Fprintf(&b, "key bytes: %d bytes %x\n", len(d.KeyBytes), d.KeyBytes)
+	fmt.Fprintf(&b, "time:      %s (%d s since epoch)\n", d.Time().Format(time.RFC3339), d.TimeOffset)
+	fmt.Fprintf(&b, "hash:      %x\n", d.Hash)
+	fmt.Fprintf(&b, "trailer:   %d", d.Trailer)
+	return b.String()
+}
+
+// DecodeTransactionID reverses the XOR with the leading random byte and
+// splits a transaction ID into its key bytes, time, hash prefix and trailing
+// byte. keyLen is the length of the verification key, 48 bytes for the live site.
+//
+// A malformed ID returns an error wrapping ErrMalformedTransactionID. When
+// only the trailing byte is wrong the breakdown is returned with the error.
+//
+// Example:
+//
+//	decoded, err := xapi.DecodeTransactionID(req.Header.Get("X-Client-Transaction-Id"), 48)
+//	if err == nil {
+//	    err = decoded.Verify("GET", req.URL.Path, animationKey)
+//	}
+func DecodeTransactionID(id string, keyLen int) (*DecodedTransactionID, error) {
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(id, "="))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedTransactionID, err)
+	}
+
+	want := 1 + keyLen + 4 + transactionHashLength + 1
+	if keyLen < 0 || len(raw) != want {
+		return nil, fmt.Errorf("%w: %d bytes, expected %d for a %d-byte key",
+			ErrMalformedTransactionID, len(raw), want, keyLen)
+	}
+
+	xorByte := raw[0]
+	plain := make([]byte, len(raw)-1)
+	for i, b := range raw[1:] {
+		plain[i] = b ^ xorByte
+	}
+
+	hashStart := keyLen + 4
+	decoded := &DecodedTransactionID{
+		XORByte:    xorByte,
+		KeyBytes:   plain[:keyLen],
+		TimeOffset: binary.LittleEndian.Uint32(plain[keyLen:hashStart]),
+		Hash:       plain[hashStart : hashStart+transactionHashLength],
+		Trailer:    plain[len(plain)-1],
+	}
+	if decoded.Trailer != AdditionalRandomNumber {
+		return decoded, fmt.Errorf("%w: trailing byte %d, expected %d",
+			ErrMalformedTransactionID, decoded.Trailer, AdditionalRandomNumber)
+	}
+	return decoded, nil
+}
+
+// InspectTransactionID decodes an ID with the generator's key length and
+// checks it against the current key material: the key bytes must match the
+// verification key and the hash must match method, path and the animation key.
+// The breakdown is returned whenever the ID could be decoded.
+func (tg *TransactionGenerator) InspectTransactionID(id, method, path string) (*DecodedTransactionID, error) {
+	snapshot := tg.snapshot.Load()
+	if snapshot == nil {
+		return nil, fmt.Errorf("transaction generator not initialized")
+	}
+
+	decoded, err := DecodeTransactionID(id, len(snapshot.keyBytes))
+	if err != nil {
+		return decoded, err
+	}
+
+	for i, b := range decoded.KeyBytes {
+		if b != byte(snapshot.keyBytes[i]) {
+			return decoded, fmt.Errorf("%w: key bytes differ from the current verification key", ErrTransactionIDMismatch)
+		}
+	}
+	return decoded, decoded.Verify(method, path, snapshot.animationKey)
+}
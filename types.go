@@ -349,7 +349,7 @@ type APIError struct {
 	Name       string                 `json:"name"`
 	Source     string                 `json:"source"`
 	Locations  []ErrorLocation        `json:"locations,omitempty"`
-	Path       []string               `json:"path,omitempty"`
+	Path       []string               `json:"path,omitempty"` // Field names; list indices as decimal strings
 	Extensions map[string]interface{} `json:"extensions,omitempty"`
 	Tracing    *ErrorTracing          `json:"tracing,omitempty"`
 }
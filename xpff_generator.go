@@ -8,12 +8,35 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 )
 
+// XPFF headers are accepted for five minutes after their created_at time.
+// Cached headers are replaced a little early so one never expires in flight.
+const (
+	XPFFValidity      = 5 * time.Minute
+	xpffRefreshMargin = 30 * time.Second
+)
+
 // XPFFGenerator handles x-xp-forwarded-for header generation
 type XPFFGenerator struct {
 	baseKey string
+
+	mu    sync.Mutex
+	cache map[xpffCacheKey]xpffCacheEntry // Reusable headers per guest ID and navigator properties
+}
+
+// xpffCacheKey identifies a header: the payload carries the navigator
+// properties and the encryption key is derived from the guest ID
+type xpffCacheKey struct {
+	guestID   string
+	navigator NavigatorProperties
+}
+
+type xpffCacheEntry struct {
+	header    string
+	createdAt int64 // Payload created_at in Unix milliseconds
 }
 
 // NavigatorProperties represents browser navigator properties
@@ -35,40 +58,131 @@ func NewXPFFGenerator() *XPFFGenerator {
 	baseKey := "0e6be1f1e21ffc33590b888fd4dc81b19713e570e805d4e5df80a493c9571a05"
 	return &XPFFGenerator{
 		baseKey: baseKey,
+		cache:   make(map[xpffCacheKey]xpffCacheEntry),
+	}
+}
+
+// Header returns an XPFF header for the guest ID and user agent, reusing the
+// last one generated for them while it has more than xpffRefreshMargin of
+// its validity left. Only a new header costs a key derivation and encryption.
+func (x *XPFFGenerator) Header(guestID, userAgent string) (string, error) {
+	return x.HeaderFor(guestID, defaultNavigator(userAgent))
+}
+
+// HeaderFor is Header with the full navigator properties of a BrowserProfile
+func (x *XPFFGenerator) HeaderFor(guestID string, navigator NavigatorProperties) (string, error) {
+	key := xpffCacheKey{guestID: guestID, navigator: navigator}
+	now := time.Now().UnixMilli()
+	reuseFor := (XPFFValidity - xpffRefreshMargin).Milliseconds()
+
+	x.mu.Lock()
+	entry, ok := x.cache[key]
+	x.mu.Unlock()
+	if ok && now-entry.createdAt < reuseFor {
+		return entry.header, nil
 	}
+
+	header, createdAt, err := x.generate(guestID, navigator, now)
+	if err != nil {
+		return "", err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.cache == nil {
+		x.cache = make(map[xpffCacheKey]xpffCacheEntry)
+	}
+	// Drop headers of guest IDs that are no longer in use
+	for k, e := range x.cache {
+		if !x.IsXPFFValid(e.createdAt) {
+			delete(x.cache, k)
+		}
+	}
+	x.cache[key] = xpffCacheEntry{header: header, createdAt: createdAt}
+	return header, nil
 }
 
-// GenerateXPFF generates the encrypted x-xp-forwarded-for header value
+// GenerateXPFF generates a new encrypted x-xp-forwarded-for header value.
+// Header reuses a still valid one instead.
 func (x *XPFFGenerator) GenerateXPFF(guestID, userAgent string) (string, error) {
+	header, _, err := x.generate(guestID, defaultNavigator(userAgent), time.Now().UnixMilli())
+	return header, err
+}
+
+// defaultNavigator returns the navigator properties of an active, non-automated browser
+func defaultNavigator(userAgent string) NavigatorProperties {
+	return NavigatorProperties{
+		HasBeenActive: "true",
+		UserAgent:     userAgent,
+		Webdriver:     "false",
+	}
+}
+
+// generate encrypts a payload created at createdAt and returns the header with its created_at
+func (x *XPFFGenerator) generate(guestID string, navigator NavigatorProperties, createdAt int64) (string, int64, error) {
 	// Create the payload
 	payload := XPFFPayload{
-		NavigatorProperties: NavigatorProperties{
-			HasBeenActive: "true",
-			UserAgent:     userAgent,
-			Webdriver:     "false",
-		},
-		CreatedAt: time.Now().UnixMilli(),
+		NavigatorProperties: navigator,
+		CreatedAt:           createdAt,
 	}
 
 	// Convert payload to JSON
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+		return "", 0, fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
 	// Generate encryption key
 	encryptionKey, err := x.generateEncryptionKey(guestID)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate encryption key: %w", err)
+		return "", 0, fmt.Errorf("failed to generate encryption key: %w", err)
 	}
 
 	// Encrypt the payload
 	encrypted, err := x.encryptAESGCM(payloadJSON, encryptionKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to encrypt payload: %w", err)
+		return "", 0, fmt.Errorf("failed to encrypt payload: %w", err)
+	}
+
+	return hex.EncodeToString(encrypted), createdAt, nil
+}
+
+// DecryptXPFF decrypts an x-xp-forwarded-for header generated for guestID,
+// such as one captured from a browser, and returns its payload. A header
+// that cannot be decrypted returns an error wrapping ErrMalformedXPFF.
+//
+// Example:
+//
+//	payload, err := xapi.NewXPFFGenerator().DecryptXPFF(header, guestID)
+//	if err == nil && !payload.Valid() {
+//	    log.Printf("header expired, created %v", time.UnixMilli(payload.CreatedAt))
+//	}
+func (x *XPFFGenerator) DecryptXPFF(header, guestID string) (*XPFFPayload, error) {
+	encrypted, err := hex.DecodeString(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedXPFF, err)
+	}
+
+	encryptionKey, err := x.generateEncryptionKey(guestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+
+	plaintext, err := x.decryptAESGCM(encrypted, encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedXPFF, err)
 	}
 
-	return hex.EncodeToString(encrypted), nil
+	var payload XPFFPayload
+	if err := json.Unmarshal(plaintext, &payload); err != nil {
+		return nil, fmt.Errorf("%w: invalid payload: %v", ErrMalformedXPFF, err)
+	}
+	return &payload, nil
+}
+
+// Valid reports whether a header with this payload is still within XPFFValidity
+func (p *XPFFPayload) Valid() bool {
+	return time.Since(time.UnixMilli(p.CreatedAt)) < XPFFValidity
 }
 
 // generateEncryptionKey derives the encryption key from base key and guest ID
@@ -111,9 +225,32 @@ func (x *XPFFGenerator) encryptAESGCM(plaintext, key []byte) ([]byte, error) {
 	return result, nil
 }
 
+// decryptAESGCM reverses encryptAESGCM: a 12-byte nonce followed by the ciphertext and tag
+func (x *XPFFGenerator) decryptAESGCM(data, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("%d bytes is too short for a nonce and tag", len(data))
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed (wrong guest ID?): %w", err)
+	}
+	return plaintext, nil
+}
+
 // IsXPFFValid checks if the XPFF header is still valid (within 5 minutes)
 func (x *XPFFGenerator) IsXPFFValid(createdAt int64) bool {
 	now := time.Now().UnixMilli()
-	// Valid for 5 minutes (300,000 milliseconds)
-	return (now - createdAt) < 300000
+	return (now - createdAt) < XPFFValidity.Milliseconds()
 }
\ No newline at end of file
@@ -0,0 +1,136 @@
+package xapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDecryptXPFF(t *testing.T) {
+	gen := NewXPFFGenerator()
+	before := time.Now().UnixMilli()
+	header, err := gen.GenerateXPFF("v1%3A170000000000000000", defaultUserAgent)
+	if err != nil {
+		t.Fatalf("GenerateXPFF failed: %v", err)
+	}
+
+	payload, err := gen.DecryptXPFF(header, "v1%3A170000000000000000")
+	if err != nil {
+		t.Fatalf("DecryptXPFF failed: %v", err)
+	}
+	props := payload.NavigatorProperties
+	if props.UserAgent != defaultUserAgent || props.HasBeenActive != "true" || props.Webdriver != "false" {
+		t.Errorf("Unexpected navigator properties: %+v", props)
+	}
+	if payload.CreatedAt < before || !payload.Valid() {
+		t.Errorf("Unexpected created_at %d", payload.CreatedAt)
+	}
+
+	// Flip the last hex digit of the authentication tag
+	last := "1"
+	if header[len(header)-1] == '1' {
+		last = "2"
+	}
+	tampered := header[:len(header)-1] + last
+
+	for name, tc := range map[string]struct{ header, guestID string }{
+		"wrong guest ID": {header, "v1%3A1"},
+		"not hex":        {"xyz", "v1%3A170000000000000000"},
+		"too short":      {header[:20], "v1%3A170000000000000000"},
+		"tampered":       {tampered, "v1%3A170000000000000000"},
+	} {
+		if _, err := gen.DecryptXPFF(tc.header, tc.guestID); !errors.Is(err, ErrMalformedXPFF) {
+			t.Errorf("%s: expected ErrMalformedXPFF, got %v", name, err)
+		}
+	}
+}
+
+func TestXPFFHeaderCache(t *testing.T) {
+	gen := NewXPFFGenerator()
+	first, err := gen.Header("guest-a", defaultUserAgent)
+	if err != nil {
+		t.Fatalf("Header failed: %v", err)
+	}
+	if again, _ := gen.Header("guest-a", defaultUserAgent); again != first {
+		t.Error("A valid header should be reused for the same guest ID")
+	}
+	if other, _ := gen.Header("guest-b", defaultUserAgent); other == first {
+		t.Error("Each guest ID needs its own header")
+	}
+	if other, _ := gen.Header("guest-a", "Other/1.0"); other == first {
+		t.Error("Each user agent needs its own header")
+	}
+
+	// Close to the end of its validity the header is replaced
+	key := xpffCacheKey{guestID: "guest-a", navigator: defaultNavigator(defaultUserAgent)}
+	gen.mu.Lock()
+	entry := gen.cache[key]
+	entry.createdAt -= (XPFFValidity - xpffRefreshMargin + time.Second).Milliseconds()
+	gen.cache[key] = entry
+	gen.mu.Unlock()
+
+	renewed, err := gen.Header("guest-a", defaultUserAgent)
+	if err != nil || renewed == first {
+		t.Fatalf("Expected a new header near expiry, got %v", err)
+	}
+	payload, err := gen.DecryptXPFF(renewed, "guest-a")
+	if err != nil || !gen.IsXPFFValid(payload.CreatedAt) {
+		t.Errorf("Renewed header should be fresh: %v", err)
+	}
+
+	// Expired entries of other guest IDs are dropped on the next miss
+	key = xpffCacheKey{guestID: "guest-b", navigator: defaultNavigator(defaultUserAgent)}
+	gen.mu.Lock()
+	entry = gen.cache[key]
+	entry.createdAt -= XPFFValidity.Milliseconds()
+	gen.cache[key] = entry
+	gen.mu.Unlock()
+	if _, err := gen.Header("guest-c", defaultUserAgent); err != nil {
+		t.Fatalf("Header failed: %v", err)
+	}
+	gen.mu.Lock()
+	_, kept := gen.cache[key]
+	gen.mu.Unlock()
+	if kept {
+		t.Error("Expired header should be dropped from the cache")
+	}
+}
+
+func TestClientReusesXPFF(t *testing.T) {
+	server := newStandIn(t)
+
+	var mu sync.Mutex
+	headers := make(map[string]bool)
+	var guestID string
+	server.handleGraphQL(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.Header.Get("X-Xp-Forwarded-For")] = true
+		if cookie, err := r.Cookie("guest_id"); err == nil {
+			guestID = cookie.Value
+		}
+		mu.Unlock()
+		fmt.Fprint(w, fixtureUserResponse)
+	})
+
+	client := server.client(t)
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		if _, err := client.User(context.Background(), "nasa"); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+
+	if len(headers) != 1 {
+		t.Fatalf("Expected one XPFF header across requests, got %d", len(headers))
+	}
+	for header := range headers {
+		payload, err := client.xpffGen.DecryptXPFF(header, guestID)
+		if err != nil || payload.NavigatorProperties.UserAgent != defaultUserAgent {
+			t.Errorf("Sent header should decrypt with the guest ID cookie: %v", err)
+		}
+	}
+}